@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// appURL returns the public base URL used to build links sent by email
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:8082"
+}
+
+// issueUserToken creates a new single-use token for the user and revokes
+// any previous unused token issued for the same purpose
+func issueUserToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	userToken := models.UserToken{
+		TokenHash: utils.HashToken(token),
+		Purpose:   purpose,
+		ExpiresAt: now.Add(ttl),
+		UserID:    userID,
+	}
+	if err := tx.Create(&userToken).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeUserToken marks a token as used and returns it. The update is
+// conditional so that a token can only be consumed once, even concurrently.
+func consumeUserToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	var userToken models.UserToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).First(&userToken).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidUserToken
+		}
+		return nil, err
+	}
+
+	if !userToken.IsUsable() {
+		return nil, errInvalidUserToken
+	}
+
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", userToken.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidUserToken
+	}
+
+	return &userToken, nil
+}
+
+// sendVerificationEmail issues a verification token and emails the link to the user
+func (h *Handler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := issueUserToken(h.DB.WithContext(ctx), user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", appURL(), url.QueryEscape(token))
+	body := fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThis link expires in %s.\n", user.Name, link, emailVerificationTTL)
+	return h.Mailer.Send(user.Email, "Verify your email address", body)
+}
+
+// VerifyEmail confirms a user's email address using the token sent at registration
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Verification token missing"})
+		return
+	}
+
+	err := h.db(c).Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeUserToken(tx, token, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", userToken.UserID).
+			Update("email_verified_at", time.Now()).Error
+	})
+	if err != nil {
+		if err == errInvalidUserToken {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+// ResendVerification sends a new verification email to an unverified account.
+// The response is identical whether or not the account exists.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var body struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user, err := h.Users.FindByEmail(c.Request.Context(), body.Email); err == nil && !user.IsEmailVerified() {
+		if err := h.sendVerificationEmail(c.Request.Context(), user); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error sending verification email", "email", user.Email, "error", err)
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "If the account exists and is not verified, a verification email has been sent"})
+}
+
+// ForgotPassword emails a password reset token to the user.
+// The response is identical whether or not the account exists.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var body struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user, err := h.Users.FindByEmail(c.Request.Context(), body.Email); err == nil {
+		token, err := issueUserToken(h.db(c), user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating reset token"})
+			return
+		}
+
+		mailBody := fmt.Sprintf("Hello %s,\n\nA password reset was requested for your account. Use the token below with POST %s/password/reset:\n\n%s\n\nThis token expires in %s. If you did not request a reset, you can ignore this email.\n", user.Name, appURL(), token, passwordResetTTL)
+		if err := h.Mailer.Send(user.Email, "Reset your password", mailBody); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error sending password reset email", "email", user.Email, "error", err)
+		}
+	} else if err != repository.ErrNotFound {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "If the account exists, a password reset email has been sent"})
+}
+
+// ResetPassword sets a new password using a password reset token
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	err = h.db(c).Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeUserToken(tx, body.Token, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		// Receiving the reset email also proves ownership of the address
+		now := time.Now()
+		if err := tx.Model(&models.User{}).Where("id = ? AND email_verified_at IS NULL", userToken.UserID).
+			Update("email_verified_at", now).Error; err != nil {
+			return err
+		}
+		// Revoke every JWT issued with the old password
+		return tx.Model(&models.User{}).Where("id = ?", userToken.UserID).Updates(map[string]interface{}{
+			"password":      string(hashedPassword),
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error
+	})
+	if err != nil {
+		if err == errInvalidUserToken {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
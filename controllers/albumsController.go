@@ -1,36 +1,117 @@
 package controllers
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
+	"strconv"
 
-	"example/web-service-gin/initializers"
 	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+// albumDetails are the relations returned with a single album
+const albumDetails = repository.WithOwner | repository.WithTags | repository.WithSongs | repository.WithTracks
+
+// isAlbumOwner reports whether the user created the album
+func isAlbumOwner(album *models.Album, userID uint) bool {
+	return album.UserID != nil && *album.UserID == userID
+}
+
+// parseID reads a record ID from a path parameter
+func parseID(value string) (uint, bool) {
+	id, err := strconv.ParseUint(value, 10, 0)
+	return uint(id), err == nil
+}
+
+// albumRole returns the user's role on the album: owner for its creator,
+// the member role otherwise, or an empty string when the user is not a member
+func (h *Handler) albumRole(ctx context.Context, album *models.Album, userID uint) (string, error) {
+	if isAlbumOwner(album, userID) {
+		return models.RoleOwner, nil
+	}
+	return h.Albums.MemberRole(ctx, album.ID, userID)
+}
+
+// findAlbum loads an album, with the given relations, on which the authenticated user
+// has at least minRole and returns it with the user's role. Public albums can be read
+// by anyone. Albums the user cannot see are reported as not found, albums they can see
+// but not act on as forbidden.
+func (h *Handler) findAlbum(c *gin.Context, with repository.Relations, id string, minRole string) (*models.Album, string, bool) {
+	userID := c.MustGet("userID").(uint)
+
+	albumID, ok := parseID(id)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album not found"})
+		return nil, "", false
+	}
+	album, err := h.Albums.FindByID(c.Request.Context(), albumID, with)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album not found"})
+			return nil, "", false
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+
+	role, err := h.albumRole(c.Request.Context(), album, userID)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+
+	rank := models.RoleRank(role)
+	if role == "" {
+		if album.Visibility != models.VisibilityPublic {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album not found"})
+			return nil, "", false
+		}
+		// Anyone can read a public album
+		rank = models.RoleRank(models.RoleViewer)
+	}
+
+	if rank < models.RoleRank(minRole) {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "You need the " + minRole + " role on this album"})
+		return nil, "", false
+	}
+
+	return album, role, true
+}
+
 // GetAlbums responds with the list of albums belonging to the authenticated user as JSON.
-func GetAlbums(c *gin.Context) {
+func (h *Handler) GetAlbums(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
 		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	userIDUint := userID.(uint)
-	var albums []models.Album
-	if err := initializers.DB.Preload("User").Preload("Tags").Where("user_id = ?", userIDUint).Find(&albums).Error; err != nil {
+	albums, err := h.Albums.ListByOwner(c.Request.Context(), userID.(uint), repository.WithOwnerAccount|repository.WithTags)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.attachAlbumListStats(c.Request.Context(), albums); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.IndentedJSON(http.StatusOK, albums)
 }
 
-// GetAllAlbums responds with the list of all albums as JSON (for browsing all albums).
-func GetAllAlbums(c *gin.Context) {
-	var albums []models.Album
-	if err := initializers.DB.Preload("User").Preload("Tags").Find(&albums).Error; err != nil {
+// GetAllAlbums responds with the albums the authenticated user can browse:
+// their own albums, albums shared with them as a member and every public album.
+func (h *Handler) GetAllAlbums(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	albums, err := h.Albums.ListVisibleTo(c.Request.Context(), userID, repository.WithOwner|repository.WithTags)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.attachAlbumListStats(c.Request.Context(), albums); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -39,15 +120,19 @@ func GetAllAlbums(c *gin.Context) {
 
 // GetAlbumByID locates the album whose ID value matches the id
 // parameter sent by the client, then returns that album as a response.
-func GetAlbumByID(c *gin.Context) {
-	id := c.Param("id")
+// Private and unlisted albums are only returned to their owner and members.
+func (h *Handler) GetAlbumByID(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, albumDetails, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
 
-	var album models.Album
-	if err := initializers.DB.Preload("User").Preload("Tags").Preload("Songs").First(&album, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album not found"})
-			return
-		}
+	if err := h.Albums.AttachStats(c.Request.Context(), album); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := attachThumbnailURLs(album); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -56,7 +141,7 @@ func GetAlbumByID(c *gin.Context) {
 }
 
 // PostAlbums adds an album from JSON received in the request body.
-func PostAlbums(c *gin.Context) {
+func (h *Handler) PostAlbums(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
 		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
@@ -64,10 +149,12 @@ func PostAlbums(c *gin.Context) {
 	}
 
 	var albumInput struct {
-		Title  string  `json:"title"`
-		Artist string  `json:"artist"`
-		Price  float64 `json:"price"`
-		TagIDs []uint  `json:"tag_ids"`
+		Title      string  `json:"title"`
+		Artist     string  `json:"artist"`
+		Price      float64 `json:"price"`
+		Visibility string  `json:"visibility"`
+		TagIDs     []uint  `json:"tag_ids"`
+		Enrich     bool    `json:"enrich"`
 	}
 
 	if err := c.BindJSON(&albumInput); err != nil {
@@ -75,31 +162,153 @@ func PostAlbums(c *gin.Context) {
 		return
 	}
 
+	if albumInput.Visibility == "" {
+		albumInput.Visibility = models.VisibilityPrivate
+	}
+	if !models.IsValidVisibility(albumInput.Visibility) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "visibility must be 'private', 'unlisted' or 'public'"})
+		return
+	}
+
 	userIDUint := userID.(uint)
 	newAlbum := models.Album{
-		Title:  albumInput.Title,
-		Artist: albumInput.Artist,
-		Price:  albumInput.Price,
-		UserID: &userIDUint,
+		Title:      albumInput.Title,
+		Artist:     albumInput.Artist,
+		Price:      albumInput.Price,
+		Visibility: albumInput.Visibility,
+		UserID:     &userIDUint,
 	}
 
 	// Associate tags if provided
 	if len(albumInput.TagIDs) > 0 {
-		var tags []models.Tag
-		if err := initializers.DB.Where("id IN ?", albumInput.TagIDs).Find(&tags).Error; err != nil {
+		tags, err := h.Tags.FindByIDs(c.Request.Context(), albumInput.TagIDs)
+		if err != nil {
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Error retrieving tags"})
 			return
 		}
 		newAlbum.Tags = tags
 	}
 
-	if err := initializers.DB.Create(&newAlbum).Error; err != nil {
+	if err := h.Albums.Create(c.Request.Context(), &newAlbum); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	recordActivity(h.db(c), models.Activity{
+		Type:    models.ActivityAlbumCreated,
+		UserID:  userIDUint,
+		AlbumID: &newAlbum.ID,
+	})
+
+	// Enrichment is best effort: the album is created even when MusicBrainz has no match
+	if albumInput.Enrich && h.Metadata != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), enrichTimeout)
+		if err := h.enrichAlbum(ctx, h.Metadata, &newAlbum, ""); err != nil {
+			slog.WarnContext(ctx, "Failed to enrich album", "album_id", newAlbum.ID, "error", err)
+		}
+		cancel()
+	}
+
 	// Reload with relations for the response
-	initializers.DB.Preload("User").Preload("Tags").First(&newAlbum, newAlbum.ID)
+	album, err := h.Albums.FindByID(c.Request.Context(), newAlbum.ID, repository.WithOwnerAccount|repository.WithTags|repository.WithTracks)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, album)
+}
+
+// UpdateAlbum changes the title, artist or price of an album, which requires the editor role,
+// or its visibility, which requires the owner role.
+func (h *Handler) UpdateAlbum(c *gin.Context) {
+	album, role, ok := h.findAlbum(c, repository.WithOwner|repository.WithTags, c.Param("id"), models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var albumInput struct {
+		Title      *string  `json:"title"`
+		Artist     *string  `json:"artist"`
+		Price      *float64 `json:"price"`
+		Visibility *string  `json:"visibility"`
+	}
+
+	if err := c.BindJSON(&albumInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if albumInput.Visibility != nil {
+		if role != models.RoleOwner {
+			c.IndentedJSON(http.StatusForbidden, gin.H{"error": "You need the owner role on this album"})
+			return
+		}
+		if !models.IsValidVisibility(*albumInput.Visibility) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "visibility must be 'private', 'unlisted' or 'public'"})
+			return
+		}
+	}
+
+	changes := repository.AlbumChanges{
+		Title:      albumInput.Title,
+		Artist:     albumInput.Artist,
+		Price:      albumInput.Price,
+		Visibility: albumInput.Visibility,
+	}
+	if err := h.Albums.Update(c.Request.Context(), album, changes); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Albums.AttachStats(c.Request.Context(), album); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, album)
+}
+
+// GetPublicAlbums lists public albums, without authentication.
+func (h *Handler) GetPublicAlbums(c *gin.Context) {
+	albums, err := h.Albums.ListPublic(c.Request.Context(), repository.WithOwner|repository.WithTags)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.attachAlbumListStats(c.Request.Context(), albums); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, albums)
+}
 
-	c.IndentedJSON(http.StatusCreated, newAlbum)
+// GetPublicAlbumByID returns a public album with its songs, without authentication.
+func (h *Handler) GetPublicAlbumByID(c *gin.Context) {
+	albumID, ok := parseID(c.Param("id"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album not found"})
+		return
+	}
+	album, err := h.Albums.FindPublic(c.Request.Context(), albumID, albumDetails)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album not found"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Albums.AttachStats(c.Request.Context(), album); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := attachThumbnailURLs(album); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, album)
 }
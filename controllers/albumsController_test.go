@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newMemoryHandler returns a handler on in-memory repositories, for the
+// handlers that only read and write albums, songs, tags and users
+func newMemoryHandler() (*Handler, *repository.Memory) {
+	memory := repository.NewMemory()
+	return &Handler{Repositories: memory.Repositories()}, memory
+}
+
+// serve calls a handler registered on route as the given user, or anonymously when userID is 0
+func serve(handler gin.HandlerFunc, method, route, path string, userID uint, body interface{}) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, route, func(c *gin.Context) {
+		if userID != 0 {
+			c.Set("userID", userID)
+		}
+	}, handler)
+
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, &payload))
+	return rec
+}
+
+func TestGetAlbumByIDRoles(t *testing.T) {
+	h, memory := newMemoryHandler()
+	alice, bob, carol := memory.AddUser("alice"), memory.AddUser("bob"), memory.AddUser("carol")
+	private := memory.AddAlbum(alice, "Private", models.VisibilityPrivate)
+	public := memory.AddAlbum(alice, "Public", models.VisibilityPublic)
+	memory.AddMember(private.ID, bob.ID, models.RoleViewer)
+
+	tests := []struct {
+		name   string
+		album  string
+		userID uint
+		want   int
+	}{
+		{"owner", fmt.Sprint(private.ID), alice.ID, http.StatusOK},
+		{"member", fmt.Sprint(private.ID), bob.ID, http.StatusOK},
+		{"stranger", fmt.Sprint(private.ID), carol.ID, http.StatusNotFound},
+		{"public album", fmt.Sprint(public.ID), carol.ID, http.StatusOK},
+		{"missing album", "9999", alice.ID, http.StatusNotFound},
+		{"invalid ID", "abc", alice.ID, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h.GetAlbumByID, http.MethodGet, "/albums/:id", "/albums/"+tt.album, tt.userID, nil)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateAlbumRoles(t *testing.T) {
+	h, memory := newMemoryHandler()
+	alice, bob, carol := memory.AddUser("alice"), memory.AddUser("bob"), memory.AddUser("carol")
+	album := memory.AddAlbum(alice, "Draft", models.VisibilityPublic)
+	memory.AddMember(album.ID, bob.ID, models.RoleEditor)
+	path := fmt.Sprintf("/albums/%d", album.ID)
+
+	// Editors change the details, only the owner changes the visibility
+	if rec := serve(h.UpdateAlbum, http.MethodPatch, "/albums/:id", path, carol.ID, gin.H{"title": "Stolen"}); rec.Code != http.StatusForbidden {
+		t.Errorf("stranger updated the album: %d", rec.Code)
+	}
+	rec := serve(h.UpdateAlbum, http.MethodPatch, "/albums/:id", path, bob.ID, gin.H{"title": "Final"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("editor could not update the album: %d %s", rec.Code, rec.Body.String())
+	}
+	var updated models.Album
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.User.Name != "alice" || updated.User.Email != "" {
+		t.Errorf("editor sees the owner as %+v", updated.User)
+	}
+	if rec := serve(h.UpdateAlbum, http.MethodPatch, "/albums/:id", path, bob.ID, gin.H{"visibility": "private"}); rec.Code != http.StatusForbidden {
+		t.Errorf("editor changed the visibility: %d", rec.Code)
+	}
+	if rec := serve(h.UpdateAlbum, http.MethodPatch, "/albums/:id", path, alice.ID, gin.H{"visibility": "secret"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid visibility accepted: %d", rec.Code)
+	}
+	if rec := serve(h.UpdateAlbum, http.MethodPatch, "/albums/:id", path, alice.ID, gin.H{"visibility": "private"}); rec.Code != http.StatusOK {
+		t.Errorf("owner could not change the visibility: %d %s", rec.Code, rec.Body.String())
+	}
+
+	stored, err := h.Albums.FindByID(context.Background(), album.ID, repository.WithoutRelations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "Final" || stored.Visibility != models.VisibilityPrivate {
+		t.Errorf("stored album %+v", stored)
+	}
+}
+
+func TestGetAllAlbums(t *testing.T) {
+	h, memory := newMemoryHandler()
+	alice, bob := memory.AddUser("alice"), memory.AddUser("bob")
+	shared := memory.AddAlbum(alice, "Shared", models.VisibilityPrivate)
+	memory.AddAlbum(alice, "Hidden", models.VisibilityUnlisted)
+	memory.AddAlbum(alice, "Public", models.VisibilityPublic)
+	memory.AddAlbum(bob, "Own", models.VisibilityPrivate)
+	memory.AddMember(shared.ID, bob.ID, models.RoleViewer)
+
+	rec := serve(h.GetAllAlbums, http.MethodGet, "/all-albums", "/all-albums", bob.ID, nil)
+	var albums []struct {
+		Title string `json:"title"`
+		User  struct {
+			Email string `json:"email"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &albums); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body.String())
+	}
+
+	var titles []string
+	for _, album := range albums {
+		titles = append(titles, album.Title)
+		if album.User.Email != "" {
+			t.Errorf("owner email of %q exposed", album.Title)
+		}
+	}
+	if fmt.Sprint(titles) != "[Shared Public Own]" {
+		t.Errorf("bob browses %v", titles)
+	}
+}
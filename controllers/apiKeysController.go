@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix makes keys easy to recognise, e.g. by secret scanners
+const apiKeyPrefix = "wsg_"
+
+func apiKeyResponse(key *models.APIKey) gin.H {
+	return gin.H{
+		"id":           key.ID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"scopes":       key.ScopeList(),
+		"created_at":   key.CreatedAt,
+		"expires_at":   key.ExpiresAt,
+		"last_used_at": key.LastUsedAt,
+	}
+}
+
+// CreateAPIKey creates a personal API key. The key itself is only returned once.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var body struct {
+		Name      string     `json:"name" binding:"required"`
+		Scopes    []string   `json:"scopes" binding:"required,min=1"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, scope := range body.Scopes {
+		if !models.IsValidScope(scope) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope, "valid_scopes": models.AllScopes})
+			return
+		}
+	}
+
+	if body.ExpiresAt != nil && body.ExpiresAt.Before(time.Now()) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	random, err := utils.GenerateRandomToken()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating API key"})
+		return
+	}
+	key := apiKeyPrefix + random
+
+	apiKey := models.APIKey{
+		Name:      body.Name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		KeyHash:   utils.HashToken(key),
+		Scopes:    strings.Join(body.Scopes, " "),
+		ExpiresAt: body.ExpiresAt,
+		UserID:    userID.(uint),
+	}
+
+	if err := h.db(c).Create(&apiKey).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := apiKeyResponse(&apiKey)
+	response["key"] = key
+	c.IndentedJSON(http.StatusCreated, response)
+}
+
+// GetAPIKeys lists the authenticated user's active API keys
+func (h *Handler) GetAPIKeys(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var keys []models.APIKey
+	if err := h.db(c).Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(keys))
+	for i := range keys {
+		response = append(response, apiKeyResponse(&keys[i]))
+	}
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// RevokeAPIKey revokes one of the authenticated user's API keys
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var key models.APIKey
+	if err := h.db(c).Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db(c).Delete(&key).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
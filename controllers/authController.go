@@ -1,18 +1,18 @@
 package controllers
 
 import (
+	"log/slog"
 	"net/http"
 
-	"example/web-service-gin/initializers"
 	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
 	"example/web-service-gin/utils"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
-func Register(c *gin.Context) {
+func (h *Handler) Register(c *gin.Context) {
 	var body struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required,min=6"`
@@ -24,8 +24,7 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	var existingUser models.User
-	if err := initializers.DB.Where("email = ?", body.Email).First(&existingUser).Error; err == nil {
+	if _, err := h.Users.FindByEmail(c.Request.Context(), body.Email); err == nil {
 		c.IndentedJSON(http.StatusConflict, gin.H{"error": "This email is already in use"})
 		return
 	}
@@ -42,28 +41,28 @@ func Register(c *gin.Context) {
 		Name:     body.Name,
 	}
 
-	if err := initializers.DB.Create(&user).Error; err != nil {
+	if err := h.Users.Create(c.Request.Context(), &user); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	token, err := utils.GenerateToken(user.ID, user.Email)
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
-		return
+	// The account stays inactive until the email address is verified
+	if err := h.sendVerificationEmail(c.Request.Context(), &user); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error sending verification email", "email", user.Email, "error", err)
 	}
 
 	c.IndentedJSON(http.StatusCreated, gin.H{
 		"user": gin.H{
-			"id":    user.ID,
-			"email": user.Email,
-			"name":  user.Name,
+			"id":             user.ID,
+			"email":          user.Email,
+			"name":           user.Name,
+			"email_verified": false,
 		},
-		"token": token,
+		"message": "Account created. Check your email to verify your address before logging in.",
 	})
 }
 
-func Login(c *gin.Context) {
+func (h *Handler) Login(c *gin.Context) {
 	var body struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required"`
@@ -74,9 +73,9 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := initializers.DB.Where("email = ?", body.Email).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	user, err := h.Users.FindByEmail(c.Request.Context(), body.Email)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Incorrect email or password"})
 			return
 		}
@@ -89,7 +88,12 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	if !user.IsEmailVerified() {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Email, user.TokenVersion)
 	if err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
@@ -105,27 +109,12 @@ func Login(c *gin.Context) {
 	})
 }
 
-func GetProfile(c *gin.Context) {
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+func (h *Handler) GetProfile(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
 		return
 	}
 
-	var user models.User
-	if err := initializers.DB.First(&user, userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "User not found"})
-			return
-		}
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"id":    user.ID,
-		"email": user.Email,
-		"name":  user.Name,
-	})
+	c.IndentedJSON(http.StatusOK, userResponse(user))
 }
 
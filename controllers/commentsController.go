@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxCommentLength limits the size of a comment body
+const maxCommentLength = 5000
+
+// CommentModerationHook inspects a comment before it is created or edited.
+// Returning an error rejects the comment and the error message is sent to the client.
+type CommentModerationHook func(comment *models.Comment) error
+
+// runCommentModerationHooks runs the handler's comment hooks in order, stopping at the first rejection
+func (h *Handler) runCommentModerationHooks(comment *models.Comment) error {
+	for _, hook := range h.CommentHooks {
+		if err := hook(comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findComment loads a comment of the album, writing a 404 when it does not exist
+func (h *Handler) findComment(c *gin.Context, albumID uint) (*models.Comment, bool) {
+	var comment models.Comment
+	if err := h.db(c).Where("id = ? AND album_id = ?", c.Param("commentId"), albumID).First(&comment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+			return nil, false
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &comment, true
+}
+
+// buildCommentThreads nests replies under their parents, keeping creation order
+func buildCommentThreads(comments []models.Comment) []models.Comment {
+	children := map[uint][]*models.Comment{}
+	var roots []*models.Comment
+	for i := range comments {
+		comment := &comments[i]
+		comment.Replies = []models.Comment{}
+		if comment.IsDeleted() {
+			comment.Body = ""
+		}
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+		} else {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+		}
+	}
+
+	var attach func(comment *models.Comment) models.Comment
+	attach = func(comment *models.Comment) models.Comment {
+		for _, child := range children[comment.ID] {
+			comment.Replies = append(comment.Replies, attach(child))
+		}
+		return *comment
+	}
+
+	threads := make([]models.Comment, 0, len(roots))
+	for _, root := range roots {
+		threads = append(threads, attach(root))
+	}
+	return threads
+}
+
+// GetAlbumComments returns the album's discussion as threads of comments and replies
+func (h *Handler) GetAlbumComments(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var comments []models.Comment
+	if err := h.db(c).Preload("User", repository.PublicUser).Where("album_id = ?", album.ID).Order("created_at, id").Find(&comments).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, buildCommentThreads(comments))
+}
+
+// CreateAlbumComment posts a comment, or a reply when parent_id is set, on an album the user can read
+func (h *Handler) CreateAlbumComment(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var commentInput struct {
+		Body     string `json:"body" binding:"required"`
+		ParentID *uint  `json:"parent_id"`
+	}
+
+	if err := c.BindJSON(&commentInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := strings.TrimSpace(commentInput.Body)
+	if body == "" || len(body) > maxCommentLength {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must contain between 1 and 5000 characters"})
+		return
+	}
+
+	if commentInput.ParentID != nil {
+		var parent models.Comment
+		if err := h.db(c).Where("id = ? AND album_id = ?", *commentInput.ParentID, album.ID).First(&parent).Error; err != nil || parent.IsDeleted() {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "parent comment not found"})
+			return
+		}
+	}
+
+	userID := c.MustGet("userID").(uint)
+	comment := models.Comment{
+		Body:     body,
+		AlbumID:  album.ID,
+		UserID:   &userID,
+		ParentID: commentInput.ParentID,
+	}
+
+	if err := h.runCommentModerationHooks(&comment); err != nil {
+		c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db(c).Create(&comment).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.db(c).Preload("User", repository.PublicUser).First(&comment, comment.ID)
+	comment.Replies = []models.Comment{}
+	c.IndentedJSON(http.StatusCreated, comment)
+}
+
+// UpdateAlbumComment edits a comment. Only its author can edit it and the previous body is kept in the history.
+func (h *Handler) UpdateAlbumComment(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	comment, ok := h.findComment(c, album.ID)
+	if !ok {
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	if comment.UserID == nil || *comment.UserID != userID {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Only the author can edit this comment"})
+		return
+	}
+	if comment.IsDeleted() {
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "Deleted comments cannot be edited"})
+		return
+	}
+
+	var commentInput struct {
+		Body string `json:"body" binding:"required"`
+	}
+
+	if err := c.BindJSON(&commentInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := strings.TrimSpace(commentInput.Body)
+	if body == "" || len(body) > maxCommentLength {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must contain between 1 and 5000 characters"})
+		return
+	}
+
+	previousBody := comment.Body
+	comment.Body = body
+	if err := h.runCommentModerationHooks(comment); err != nil {
+		c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	if body != previousBody {
+		now := time.Now()
+		err := h.db(c).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&models.CommentRevision{CommentID: comment.ID, Body: previousBody}).Error; err != nil {
+				return err
+			}
+			return tx.Model(comment).Updates(map[string]interface{}{"body": body, "edited_at": now}).Error
+		})
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	h.db(c).Preload("User", repository.PublicUser).First(comment, comment.ID)
+	comment.Replies = []models.Comment{}
+	c.IndentedJSON(http.StatusOK, comment)
+}
+
+// DeleteAlbumComment soft deletes a comment. Authors can delete their own comments;
+// album owners and admins can remove any comment, optionally giving a reason.
+func (h *Handler) DeleteAlbumComment(c *gin.Context) {
+	album, role, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	comment, ok := h.findComment(c, album.ID)
+	if !ok {
+		return
+	}
+	if comment.IsDeleted() {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	isAuthor := comment.UserID != nil && *comment.UserID == user.ID
+	isModerator := role == models.RoleOwner || user.IsAdmin
+	if !isAuthor && !isModerator {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Only the author, the album owner or an admin can delete this comment"})
+		return
+	}
+
+	// The body is optional: moderators may explain why a comment was removed
+	var deleteInput struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&deleteInput); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	updates := map[string]interface{}{
+		"deleted_at":    time.Now(),
+		"deleted_by_id": user.ID,
+		"body":          "",
+	}
+	if !isAuthor {
+		updates["moderation_reason"] = deleteInput.Reason
+	}
+
+	if err := h.db(c).Model(comment).Updates(updates).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Comment deleted"})
+}
+
+// GetAlbumCommentHistory lists the previous versions of an edited comment, most recent first
+func (h *Handler) GetAlbumCommentHistory(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	comment, ok := h.findComment(c, album.ID)
+	if !ok {
+		return
+	}
+	if comment.IsDeleted() {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+
+	var revisions []models.CommentRevision
+	if err := h.db(c).Where("comment_id = ?", comment.ID).Order("created_at DESC, id DESC").Find(&revisions).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, revisions)
+}
+
+// deleteAlbumComments removes the discussion of deleted albums
+func deleteAlbumComments(tx *gorm.DB, albumIDs []uint) error {
+	comments := tx.Model(&models.Comment{}).Select("id").Where("album_id IN ?", albumIDs)
+	if err := tx.Where("comment_id IN (?)", comments).Delete(&models.CommentRevision{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("album_id IN ?", albumIDs).Delete(&models.Comment{}).Error
+}
+
+// anonymizeUserComments keeps a deleted user's comments in their threads as deleted, without author
+func anonymizeUserComments(tx *gorm.DB, userID uint) error {
+	comments := tx.Model(&models.Comment{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("comment_id IN (?)", comments).Delete(&models.CommentRevision{}).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.Comment{}).Where("user_id = ? AND deleted_at IS NULL", userID).
+		Updates(map[string]interface{}{"deleted_at": now, "deleted_by_id": userID}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Comment{}).Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"user_id": nil, "body": ""}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Comment{}).Where("deleted_by_id = ?", userID).Update("deleted_by_id", nil).Error
+}
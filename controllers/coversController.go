@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxCoverSize limits the size of an uploaded cover file
+	maxCoverSize = 10 << 20
+	// maxCoverPixels limits the dimensions of an uploaded cover, about 8000x5000
+	maxCoverPixels = 40_000_000
+	// coverThumbnailQuality is the JPEG quality of the generated thumbnails
+	coverThumbnailQuality = 85
+)
+
+// removeCoverImages deletes a cover and its thumbnails from storage. Failures only
+// leave orphaned files behind, so they are logged rather than reported.
+func (h *Handler) removeCoverImages(ctx context.Context, coverKey string) {
+	if coverKey == "" {
+		return
+	}
+	keys := []string{coverKey}
+	for _, size := range models.CoverThumbnailSizes {
+		keys = append(keys, models.CoverThumbnailKey(coverKey, size))
+	}
+	for _, key := range keys {
+		if err := h.Storage.Delete(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete from storage", "key", key, "error", err)
+		}
+	}
+}
+
+// UploadAlbumCover replaces an album's cover with the image uploaded in the "image" field.
+// The type is sniffed from the content; JPEG, PNG and GIF images are accepted and
+// resized into JPEG thumbnails.
+func (h *Handler) UploadAlbumCover(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart headers around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCoverSize+1<<20)
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "The image must not exceed 10 MB"})
+			return
+		}
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "an image file is required in the 'image' field"})
+		return
+	}
+	if fileHeader.Size > maxCoverSize {
+		c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "The image must not exceed 10 MB"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxCoverSize))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	img, contentType, extension, err := utils.DecodeImage(data, maxCoverPixels)
+	switch {
+	case errors.Is(err, utils.ErrUnsupportedImage):
+		c.IndentedJSON(http.StatusUnsupportedMediaType, gin.H{"error": "The image must be a JPEG, PNG or GIF file"})
+		return
+	case errors.Is(err, utils.ErrImageTooLarge):
+		c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"error": "The image dimensions are too large"})
+		return
+	case err != nil:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Every upload gets new random keys so cached copies of the previous cover are never served
+	random, err := utils.GenerateRandomToken()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to store the image"})
+		return
+	}
+	coverKey := fmt.Sprintf("covers/%d/%s/original%s", album.ID, random[:16], extension)
+
+	ctx := c.Request.Context()
+	if err := h.Storage.Put(ctx, coverKey, data, contentType); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to store album cover", "album_id", album.ID, "error", err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to store the image"})
+		return
+	}
+	flat := utils.FlattenImage(img)
+	for _, size := range models.CoverThumbnailSizes {
+		thumbnail, err := utils.EncodeJPEG(utils.ResizeToFit(flat, size), coverThumbnailQuality)
+		if err == nil {
+			err = h.Storage.Put(ctx, models.CoverThumbnailKey(coverKey, size), thumbnail, "image/jpeg")
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to store album cover thumbnail", "album_id", album.ID, "error", err)
+			h.removeCoverImages(ctx, coverKey)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to store the image"})
+			return
+		}
+	}
+
+	previousKey := album.CoverKey
+	if err := h.Albums.SetCoverKey(ctx, album, coverKey); err != nil {
+		h.removeCoverImages(ctx, coverKey)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.removeCoverImages(ctx, previousKey)
+
+	album, err = h.Albums.FindByID(ctx, album.ID, repository.WithOwner|repository.WithTags)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, album)
+}
+
+// DeleteAlbumCover removes an album's uploaded cover
+func (h *Handler) DeleteAlbumCover(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleEditor)
+	if !ok {
+		return
+	}
+	if album.CoverKey == "" {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "This album has no cover"})
+		return
+	}
+
+	coverKey := album.CoverKey
+	if err := h.Albums.SetCoverKey(c.Request.Context(), album, ""); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.removeCoverImages(c.Request.Context(), coverKey)
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Cover removed"})
+}
+
+// GetMedia serves an uploaded file. Keys contain a random part, so covers can be
+// embedded in pages without authentication and cached forever.
+func (h *Handler) GetMedia(c *gin.Context) {
+	key, err := utils.CleanStorageKey(c.Param("key"))
+	if err != nil || !strings.HasPrefix(key, "covers/") {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	reader, contentType, err := h.Storage.Get(c.Request.Context(), key)
+	if errors.Is(err, utils.ErrObjectNotFound) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, -1, contentType, reader, nil)
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// enrichTimeout bounds the MusicBrainz requests made for one album
+const enrichTimeout = 15 * time.Second
+
+// enrichAlbum fetches the release metadata of an album and stores it with the track listing.
+// The release is the given MBID, the one the album was enriched from before, or the best search match.
+func (h *Handler) enrichAlbum(ctx context.Context, client utils.MetadataClient, album *models.Album, mbid string) error {
+	if mbid == "" {
+		mbid = album.MBID
+	}
+	if mbid == "" {
+		found, err := client.SearchRelease(ctx, album.Artist, album.Title)
+		if err != nil {
+			return err
+		}
+		mbid = found
+	}
+
+	metadata, err := client.LookupRelease(ctx, mbid)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return h.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(album).Updates(map[string]interface{}{
+			"mbid":          metadata.MBID,
+			"release_year":  metadata.ReleaseYear,
+			"label":         metadata.Label,
+			"cover_art_url": metadata.CoverArtURL,
+			"enriched_at":   now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("album_id = ?", album.ID).Delete(&models.AlbumTrack{}).Error; err != nil {
+			return err
+		}
+		if len(metadata.Tracks) == 0 {
+			return nil
+		}
+		tracks := make([]models.AlbumTrack, 0, len(metadata.Tracks))
+		for _, track := range metadata.Tracks {
+			tracks = append(tracks, models.AlbumTrack{
+				Position: track.Position,
+				Title:    track.Title,
+				LengthMs: track.LengthMs,
+				AlbumID:  album.ID,
+			})
+		}
+		return tx.Create(&tracks).Error
+	})
+}
+
+// EnrichAlbum fills in an album's release year, label, cover art and track listing from MusicBrainz.
+// An optional mbid in the body selects the release when the search picks the wrong one.
+func (h *Handler) EnrichAlbum(c *gin.Context) {
+	if h.Metadata == nil {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "Album enrichment is not configured"})
+		return
+	}
+
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var enrichInput struct {
+		MBID string `json:"mbid"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&enrichInput); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), enrichTimeout)
+	defer cancel()
+
+	if err := h.enrichAlbum(ctx, h.Metadata, album, enrichInput.MBID); err != nil {
+		if errors.Is(err, utils.ErrReleaseNotFound) {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No matching release found on MusicBrainz"})
+			return
+		}
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": "MusicBrainz lookup failed: " + err.Error()})
+		return
+	}
+
+	album, err := h.Albums.FindByID(c.Request.Context(), album.ID, repository.WithOwner|repository.WithTags|repository.WithTracks)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.Albums.AttachStats(c.Request.Context(), album); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, album)
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/web-service-gin/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is the number of albums loaded in memory at once while exporting
+const exportBatchSize = 100
+
+// libraryFormatVersion is written in JSON exports so future imports can read older files
+const libraryFormatVersion = 1
+
+// libraryCSVHeader lists the columns of the CSV export; each row is a song,
+// albums without songs have a single row with empty song columns
+var libraryCSVHeader = []string{"album_title", "album_artist", "album_price", "album_visibility", "album_tags", "song_title", "youtube_url", "thumbnail_url", "view_count"}
+
+// csvTagSeparator separates the tag names of the album_tags column
+const csvTagSeparator = "|"
+
+// csvFormulaPrefixes start the cells spreadsheets evaluate as formulas
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell escapes a text cell with a leading quote so spreadsheets display it
+// instead of evaluating it as a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvValue reads a cell escaped by csvCell
+func csvValue(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// exportedAlbum is an album in the library export format
+type exportedAlbum struct {
+	Title      string         `json:"title"`
+	Artist     string         `json:"artist"`
+	Price      float64        `json:"price"`
+	Visibility string         `json:"visibility"`
+	Tags       []string       `json:"tags"`
+	Songs      []exportedSong `json:"songs"`
+}
+
+// exportedSong is a song in the library export format
+type exportedSong struct {
+	Title        string `json:"title"`
+	YoutubeURL   string `json:"youtube_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ViewCount    int64  `json:"view_count"`
+}
+
+func newExportedAlbum(album *models.Album) exportedAlbum {
+	exported := exportedAlbum{
+		Title:      album.Title,
+		Artist:     album.Artist,
+		Price:      album.Price,
+		Visibility: album.Visibility,
+		Tags:       []string{},
+		Songs:      []exportedSong{},
+	}
+	for _, tag := range album.Tags {
+		exported.Tags = append(exported.Tags, tag.Name)
+	}
+	for _, song := range album.Songs {
+		exported.Songs = append(exported.Songs, exportedSong{
+			Title:        song.Title,
+			YoutubeURL:   song.YoutubeURL,
+			ThumbnailURL: song.ThumbnailURL,
+			ViewCount:    song.ViewCount,
+		})
+	}
+	return exported
+}
+
+// libraryWriter writes albums in one of the export formats
+type libraryWriter interface {
+	begin() error
+	writeAlbum(album exportedAlbum) error
+	end() error
+}
+
+type jsonLibraryWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonLibraryWriter) begin() error {
+	_, err := fmt.Fprintf(j.w, "{\"version\":%d,\"exported_at\":%q,\"albums\":[", libraryFormatVersion, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (j *jsonLibraryWriter) writeAlbum(album exportedAlbum) error {
+	data, err := json.Marshal(album)
+	if err != nil {
+		return err
+	}
+	if j.count > 0 {
+		if _, err := j.w.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	j.count++
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonLibraryWriter) end() error {
+	_, err := j.w.Write([]byte("]}\n"))
+	return err
+}
+
+type csvLibraryWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvLibraryWriter) begin() error {
+	return c.w.Write(libraryCSVHeader)
+}
+
+func (c *csvLibraryWriter) writeAlbum(album exportedAlbum) error {
+	albumColumns := []string{
+		csvCell(album.Title),
+		csvCell(album.Artist),
+		strconv.FormatFloat(album.Price, 'f', -1, 64),
+		album.Visibility,
+		csvCell(strings.Join(album.Tags, csvTagSeparator)),
+	}
+	if len(album.Songs) == 0 {
+		if err := c.w.Write(append(albumColumns, "", "", "", "")); err != nil {
+			return err
+		}
+	}
+	for _, song := range album.Songs {
+		row := append(append([]string{}, albumColumns...), csvCell(song.Title), csvCell(song.YoutubeURL), csvCell(song.ThumbnailURL), strconv.FormatInt(song.ViewCount, 10))
+		if err := c.w.Write(row); err != nil {
+			return err
+		}
+	}
+	// Flush every album so the rows are streamed instead of buffered
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvLibraryWriter) end() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type m3uLibraryWriter struct {
+	w io.Writer
+}
+
+func (m *m3uLibraryWriter) begin() error {
+	_, err := io.WriteString(m.w, "#EXTM3U\n")
+	return err
+}
+
+func (m *m3uLibraryWriter) writeAlbum(album exportedAlbum) error {
+	for _, song := range album.Songs {
+		if _, err := fmt.Fprintf(m.w, "#EXTINF:-1,%s - %s\n%s\n", m3uText(album.Artist), m3uText(song.Title), song.YoutubeURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *m3uLibraryWriter) end() error {
+	return nil
+}
+
+// ExportLibrary streams the albums the user owns, with their tags and songs, as JSON, CSV or M3U.
+// Albums are read in batches so large libraries are never loaded in memory at once.
+func (h *Handler) ExportLibrary(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var writer libraryWriter
+	var contentType, extension string
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		writer, contentType, extension = &jsonLibraryWriter{w: c.Writer}, "application/json; charset=utf-8", "json"
+	case "csv":
+		writer, contentType, extension = &csvLibraryWriter{w: csv.NewWriter(c.Writer)}, "text/csv; charset=utf-8", "csv"
+	case "m3u":
+		writer, contentType, extension = &m3uLibraryWriter{w: c.Writer}, "audio/x-mpegurl; charset=utf-8", "m3u"
+	default:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "format must be 'json', 'csv' or 'm3u'"})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"library-%s.%s\"", time.Now().Format("2006-01-02"), extension))
+	c.Status(http.StatusOK)
+
+	// Once streaming started the status can no longer change; errors truncate the response
+	if err := writer.begin(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Library export failed", "user_id", userID, "error", err)
+		return
+	}
+
+	var albums []models.Album
+	result := h.db(c).
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("name") }).
+		Preload("Songs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("user_id = ?", userID).Order("id").
+		FindInBatches(&albums, exportBatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range albums {
+				if err := writer.writeAlbum(newExportedAlbum(&albums[i])); err != nil {
+					return err
+				}
+			}
+			c.Writer.Flush()
+			return nil
+		})
+	if result.Error != nil {
+		slog.ErrorContext(c.Request.Context(), "Library export failed", "user_id", userID, "error", result.Error)
+		return
+	}
+
+	if err := writer.end(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Library export failed", "user_id", userID, "error", err)
+	}
+}
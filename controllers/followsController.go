@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+// recordActivity adds an event to the user's activity stream. Activities are informative,
+// so a failure is logged rather than failing the request that triggered it.
+func recordActivity(db *gorm.DB, activity models.Activity) {
+	if err := db.Create(&activity).Error; err != nil {
+		slog.ErrorContext(db.Statement.Context, "Failed to record activity", "type", activity.Type, "user_id", activity.UserID, "error", err)
+	}
+}
+
+// findUser loads the user from the :id parameter, writing a 404 when it does not exist
+func (h *Handler) findUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := parseID(c.Param("id"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	user, err := h.Users.FindPublic(c.Request.Context(), userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return nil, false
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return user, true
+}
+
+// FollowUser makes the authenticated user follow another user. Following twice has no effect.
+func (h *Handler) FollowUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	if user.ID == userID {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "You cannot follow yourself"})
+		return
+	}
+
+	follow := models.Follow{FollowerID: userID, FollowedID: user.ID}
+	if err := h.db(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&follow).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "You now follow " + user.Name})
+}
+
+// UnfollowUser stops following a user
+func (h *Handler) UnfollowUser(c *gin.Context) {
+	if err := h.db(c).Where("follower_id = ? AND followed_id = ?", c.MustGet("userID"), c.Param("id")).
+		Delete(&models.Follow{}).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "User unfollowed"})
+}
+
+// GetFollowing lists the users the authenticated user follows
+func (h *Handler) GetFollowing(c *gin.Context) {
+	following := h.db(c).Model(&models.Follow{}).Select("followed_id").Where("follower_id = ?", c.MustGet("userID"))
+
+	var users []models.User
+	if err := repository.PublicUser(h.db(c)).Where("id IN (?)", following).Order("name").Find(&users).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, users)
+}
+
+// GetFollowers lists the users following the authenticated user
+func (h *Handler) GetFollowers(c *gin.Context) {
+	followers := h.db(c).Model(&models.Follow{}).Select("follower_id").Where("followed_id = ?", c.MustGet("userID"))
+
+	var users []models.User
+	if err := repository.PublicUser(h.db(c)).Where("id IN (?)", followers).Order("name").Find(&users).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, users)
+}
+
+// GetFeed returns the recent activity of the users the authenticated user follows, newest first.
+// Activities on albums the user cannot read are left out. Pages are chained with the
+// next_cursor of the previous response, which stays stable while new activities are added.
+func (h *Handler) GetFeed(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	limit := defaultFeedLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxFeedLimit {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = parsed
+	}
+
+	following := h.db(c).Model(&models.Follow{}).Select("followed_id").Where("follower_id = ?", userID)
+	visible := repository.VisibleAlbums(h.db(c).Model(&models.Album{}).Select("albums.id"), userID)
+	query := h.db(c).
+		Preload("User", repository.PublicUser).Preload("Album").Preload("Song").Preload("Tag").
+		Where("user_id IN (?)", following).
+		Where("album_id IS NULL OR album_id IN (?)", visible)
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		before, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		query = query.Where("id < ?", before)
+	}
+
+	// Fetch one more activity than requested to know whether there is a next page
+	var activities []models.Activity
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&activities).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var nextCursor *string
+	if len(activities) > limit {
+		activities = activities[:limit]
+		cursor := strconv.FormatUint(uint64(activities[limit-1].ID), 10)
+		nextCursor = &cursor
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"activities":  activities,
+		"next_cursor": nextCursor,
+	})
+}
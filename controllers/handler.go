@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the API routes. Its dependencies are built in main, so tests
+// can run several handlers side by side, each with its own database.
+type Handler struct {
+	// Albums, songs, tags and users are read and written through the repositories;
+	// DB serves the other records and the operations spanning several of them
+	repository.Repositories
+	DB *gorm.DB
+
+	Mailer utils.Mailer
+	// Storage holds uploaded files such as album covers
+	Storage utils.Storage
+	// Metadata is nil when album enrichment is disabled
+	Metadata utils.MetadataClient
+	// OIDC is nil when no external identity provider is configured
+	OIDC *utils.OIDCProvider
+	// VideoInfo looks up YouTube video metadata through a cache
+	VideoInfo *utils.VideoInfoCache
+	// Thumbnails caches the song thumbnails served by GetSongThumbnail
+	Thumbnails *utils.ThumbnailCache
+	// CommentHooks run in order on every new or edited comment, e.g. spam or word filters
+	CommentHooks []CommentModerationHook
+}
+
+// db returns the database bound to the context of the request, so its SQL logs
+// carry the request ID and its queries stop when the client goes away
+func (h *Handler) db(c *gin.Context) *gorm.DB {
+	return h.DB.WithContext(c.Request.Context())
+}
@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxImportSize limits the size of an uploaded library file
+const maxImportSize = 10 << 20
+
+// errDryRun rolls back the import transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// discogsArtistSuffix matches the number Discogs appends to disambiguate artists, e.g. "Nirvana (2)"
+var discogsArtistSuffix = regexp.MustCompile(`\s+\(\d+\)$`)
+
+// importedAlbum is an album read from an import file. A nil price or an empty
+// visibility keeps the value of an existing album.
+type importedAlbum struct {
+	Title      string         `json:"title"`
+	Artist     string         `json:"artist"`
+	Price      *float64       `json:"price"`
+	Visibility string         `json:"visibility"`
+	Tags       []string       `json:"tags"`
+	Songs      []exportedSong `json:"songs"`
+
+	// source locates the album in the file for error messages
+	source string
+}
+
+// importError reports a problem with an album or a line of the import file
+type importError struct {
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+// importChange describes what the import does to an album
+type importChange struct {
+	Action     string   `json:"action"`
+	Title      string   `json:"title"`
+	Artist     string   `json:"artist"`
+	Fields     []string `json:"updated_fields,omitempty"`
+	TagsAdded  []string `json:"tags_added,omitempty"`
+	SongsAdded int      `json:"songs_added,omitempty"`
+}
+
+// importReport summarises an import, or what it would do in a dry run
+type importReport struct {
+	DryRun        bool           `json:"dry_run"`
+	AlbumsCreated int            `json:"albums_created"`
+	AlbumsUpdated int            `json:"albums_updated"`
+	AlbumsSkipped int            `json:"albums_unchanged"`
+	TagsCreated   []string       `json:"tags_created"`
+	SongsAdded    int            `json:"songs_added"`
+	Changes       []importChange `json:"changes"`
+	Errors        []importError  `json:"errors,omitempty"`
+}
+
+// csvColumns maps import fields to the columns of a CSV file
+type csvColumns map[string]string
+
+// csvImportFields are the fields a CSV column mapping can set
+var csvImportFields = map[string]bool{
+	"title": true, "artist": true, "price": true, "visibility": true, "tags": true,
+	"song_title": true, "youtube_url": true, "thumbnail_url": true, "view_count": true,
+}
+
+// defaultCSVColumns reads the CSV files produced by GET /export?format=csv
+var defaultCSVColumns = csvColumns{
+	"title": "album_title", "artist": "album_artist", "price": "album_price", "visibility": "album_visibility",
+	"tags": "album_tags", "song_title": "song_title", "youtube_url": "youtube_url",
+	"thumbnail_url": "thumbnail_url", "view_count": "view_count",
+}
+
+// parseLibraryJSON reads a file produced by GET /export?format=json
+func parseLibraryJSON(r io.Reader) ([]importedAlbum, error) {
+	var library struct {
+		Version int             `json:"version"`
+		Albums  []importedAlbum `json:"albums"`
+	}
+	if err := json.NewDecoder(r).Decode(&library); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if library.Version > libraryFormatVersion {
+		return nil, fmt.Errorf("unsupported export version %d", library.Version)
+	}
+	for i := range library.Albums {
+		library.Albums[i].source = fmt.Sprintf("album %d", i+1)
+	}
+	return library.Albums, nil
+}
+
+// readCSV reads the header and rows of a CSV file, calling row with a column
+// lookup function for each line. Rows are grouped into albums by title and artist.
+func readCSV(r io.Reader, required []string, row func(get func(column string) string) (*importedAlbum, *exportedSong, error)) ([]importedAlbum, []importError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, column := range required {
+		if _, ok := index[column]; !ok {
+			return nil, nil, fmt.Errorf("missing column %q", column)
+		}
+	}
+
+	var albums []importedAlbum
+	var rowErrors []importError
+	positions := map[string]int{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		get := func(column string) string {
+			if i, ok := index[column]; ok && column != "" && i < len(record) {
+				return strings.TrimSpace(csvValue(record[i]))
+			}
+			return ""
+		}
+		album, song, err := row(get)
+		if err != nil {
+			rowErrors = append(rowErrors, importError{Source: fmt.Sprintf("line %d", line), Error: err.Error()})
+			continue
+		}
+
+		key := album.Title + "\x00" + album.Artist
+		position, exists := positions[key]
+		if !exists {
+			album.source = fmt.Sprintf("line %d", line)
+			albums = append(albums, *album)
+			position = len(albums) - 1
+			positions[key] = position
+		}
+		if song != nil {
+			albums[position].Songs = append(albums[position].Songs, *song)
+		}
+	}
+	return albums, rowErrors, nil
+}
+
+// parseLibraryCSV reads a CSV file whose columns are described by the mapping
+func parseLibraryCSV(r io.Reader, columns csvColumns) ([]importedAlbum, []importError, error) {
+	if columns["title"] == "" {
+		return nil, nil, errors.New("the column mapping must include title")
+	}
+	var required []string
+	for _, column := range columns {
+		if column != "" {
+			required = append(required, column)
+		}
+	}
+
+	return readCSV(r, required, func(get func(string) string) (*importedAlbum, *exportedSong, error) {
+		album := &importedAlbum{
+			Title:      get(columns["title"]),
+			Artist:     get(columns["artist"]),
+			Visibility: get(columns["visibility"]),
+		}
+		if value := get(columns["price"]); value != "" {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid price %q", value)
+			}
+			album.Price = &price
+		}
+		for _, tag := range strings.Split(get(columns["tags"]), csvTagSeparator) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				album.Tags = append(album.Tags, tag)
+			}
+		}
+
+		youtubeURL := get(columns["youtube_url"])
+		if youtubeURL == "" {
+			return album, nil, nil
+		}
+		song := &exportedSong{
+			Title:        get(columns["song_title"]),
+			YoutubeURL:   youtubeURL,
+			ThumbnailURL: get(columns["thumbnail_url"]),
+		}
+		if value := get(columns["view_count"]); value != "" {
+			viewCount, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid view_count %q", value)
+			}
+			song.ViewCount = viewCount
+		}
+		return album, song, nil
+	})
+}
+
+// parseDiscogsCSV reads a Discogs collection export. Albums are tagged with their
+// collection folder; Discogs exports have no price or songs.
+func parseDiscogsCSV(r io.Reader) ([]importedAlbum, []importError, error) {
+	return readCSV(r, []string{"Artist", "Title"}, func(get func(string) string) (*importedAlbum, *exportedSong, error) {
+		album := &importedAlbum{
+			Title:  get("Title"),
+			Artist: discogsArtistSuffix.ReplaceAllString(get("Artist"), ""),
+		}
+		if folder := get("CollectionFolder"); folder != "" && folder != "Uncategorized" {
+			album.Tags = append(album.Tags, folder)
+		}
+		return album, nil, nil
+	})
+}
+
+// validateImportedAlbum checks an album before anything is written
+func validateImportedAlbum(album *importedAlbum) error {
+	if strings.TrimSpace(album.Title) == "" {
+		return errors.New("title is required")
+	}
+	if album.Visibility != "" && !models.IsValidVisibility(album.Visibility) {
+		return fmt.Errorf("invalid visibility %q", album.Visibility)
+	}
+	if album.Price != nil && *album.Price < 0 {
+		return errors.New("price cannot be negative")
+	}
+	for _, song := range album.Songs {
+		if _, err := utils.ExtractVideoID(song.YoutubeURL); err != nil {
+			return fmt.Errorf("invalid YouTube URL %q", song.YoutubeURL)
+		}
+	}
+	return nil
+}
+
+// libraryImporter upserts imported albums, tags and songs of a user in a transaction
+type libraryImporter struct {
+	tx     *gorm.DB
+	userID uint
+	report *importReport
+	tags   map[string]models.Tag
+}
+
+// tag returns the tag with the given name, creating it when needed
+func (im *libraryImporter) tag(name string) (models.Tag, error) {
+	if tag, ok := im.tags[name]; ok {
+		return tag, nil
+	}
+
+	var tag models.Tag
+	err := im.tx.Where("name = ?", name).First(&tag).Error
+	if err == gorm.ErrRecordNotFound {
+		tag = models.Tag{Name: name}
+		err = im.tx.Create(&tag).Error
+		im.report.TagsCreated = append(im.report.TagsCreated, name)
+	}
+	if err != nil {
+		return tag, err
+	}
+	im.tags[name] = tag
+	return tag, nil
+}
+
+// upsert creates the album, or completes the user's existing album with the same title and artist.
+// Existing tags and songs are kept; songs are matched by YouTube URL.
+func (im *libraryImporter) upsert(imported *importedAlbum) error {
+	var album models.Album
+	err := im.tx.Preload("Tags").Preload("Songs").
+		Where("user_id = ? AND title = ? AND artist = ?", im.userID, imported.Title, imported.Artist).First(&album).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	change := importChange{Action: "update", Title: imported.Title, Artist: imported.Artist}
+	if err == gorm.ErrRecordNotFound {
+		change.Action = "create"
+		album = models.Album{
+			Title:      imported.Title,
+			Artist:     imported.Artist,
+			Visibility: models.VisibilityPrivate,
+			UserID:     &im.userID,
+		}
+		if imported.Price != nil {
+			album.Price = *imported.Price
+		}
+		if imported.Visibility != "" {
+			album.Visibility = imported.Visibility
+		}
+		if err := im.tx.Omit("Tags", "Songs").Create(&album).Error; err != nil {
+			return err
+		}
+	} else {
+		updates := map[string]interface{}{}
+		if imported.Price != nil && *imported.Price != album.Price {
+			updates["price"] = *imported.Price
+			change.Fields = append(change.Fields, "price")
+		}
+		if imported.Visibility != "" && imported.Visibility != album.Visibility {
+			updates["visibility"] = imported.Visibility
+			change.Fields = append(change.Fields, "visibility")
+		}
+		if len(updates) > 0 {
+			if err := im.tx.Model(&album).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	hasTag := map[string]bool{}
+	for _, tag := range album.Tags {
+		hasTag[tag.Name] = true
+	}
+	var newTags []models.Tag
+	for _, name := range imported.Tags {
+		if hasTag[name] {
+			continue
+		}
+		hasTag[name] = true
+		tag, err := im.tag(name)
+		if err != nil {
+			return err
+		}
+		newTags = append(newTags, tag)
+		change.TagsAdded = append(change.TagsAdded, name)
+	}
+	if len(newTags) > 0 {
+		if err := im.tx.Model(&album).Association("Tags").Append(newTags); err != nil {
+			return err
+		}
+	}
+
+	hasSong := map[string]bool{}
+	for _, song := range album.Songs {
+		hasSong[song.YoutubeURL] = true
+	}
+	for _, imported := range imported.Songs {
+		if hasSong[imported.YoutubeURL] {
+			continue
+		}
+		hasSong[imported.YoutubeURL] = true
+		song := models.Song{
+			Title:        imported.Title,
+			YoutubeURL:   imported.YoutubeURL,
+			ThumbnailURL: imported.ThumbnailURL,
+			ViewCount:    imported.ViewCount,
+			AlbumID:      album.ID,
+		}
+		if err := im.tx.Create(&song).Error; err != nil {
+			return err
+		}
+		change.SongsAdded++
+	}
+	im.report.SongsAdded += change.SongsAdded
+
+	switch {
+	case change.Action == "create":
+		im.report.AlbumsCreated++
+	case len(change.Fields) > 0 || len(change.TagsAdded) > 0 || change.SongsAdded > 0:
+		im.report.AlbumsUpdated++
+	default:
+		im.report.AlbumsSkipped++
+		return nil
+	}
+	im.report.Changes = append(im.report.Changes, change)
+	return nil
+}
+
+// ImportLibrary imports albums from an uploaded file (multipart field "file"):
+// format=json reads our own export, format=csv a CSV whose columns are given by the
+// optional "mapping" field, format=discogs a Discogs collection export.
+// Albums are matched by title and artist and upserted in a single transaction;
+// with dry_run=true the changes are reported but not saved.
+func (h *Handler) ImportLibrary(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	dryRun := c.Query("dry_run") == "true"
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "a library file is required in the 'file' field"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	var albums []importedAlbum
+	var importErrors []importError
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		albums, err = parseLibraryJSON(file)
+	case "csv":
+		columns := defaultCSVColumns
+		if mapping := c.PostForm("mapping"); mapping != "" {
+			columns = csvColumns{}
+			if err := json.Unmarshal([]byte(mapping), &columns); err != nil {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of field to column name"})
+				return
+			}
+			for field := range columns {
+				if !csvImportFields[field] {
+					c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "unknown mapping field: " + field})
+					return
+				}
+			}
+		}
+		albums, importErrors, err = parseLibraryCSV(file, columns)
+	case "discogs":
+		albums, importErrors, err = parseDiscogsCSV(file)
+	default:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "format must be 'json', 'csv' or 'discogs'"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for i := range albums {
+		if err := validateImportedAlbum(&albums[i]); err != nil {
+			importErrors = append(importErrors, importError{Source: albums[i].source, Error: err.Error()})
+		}
+	}
+
+	report := importReport{DryRun: dryRun, TagsCreated: []string{}, Changes: []importChange{}}
+	if len(importErrors) > 0 {
+		// Nothing is imported unless the whole file is valid
+		report.Errors = importErrors
+		c.IndentedJSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	err = h.db(c).Transaction(func(tx *gorm.DB) error {
+		importer := &libraryImporter{tx: tx, userID: userID, report: &report, tags: map[string]models.Tag{}}
+		for i := range albums {
+			if err := importer.upsert(&albums[i]); err != nil {
+				return fmt.Errorf("%s: %w", albums[i].source, err)
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, report)
+}
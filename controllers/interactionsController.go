@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// attachAlbumListStats fills the statistics of a slice of albums
+func (h *Handler) attachAlbumListStats(ctx context.Context, albums []models.Album) error {
+	ptrs := make([]*models.Album, len(albums))
+	for i := range albums {
+		ptrs[i] = &albums[i]
+	}
+	return h.Albums.AttachStats(ctx, ptrs...)
+}
+
+// attachSongListStats fills the like counts of a slice of songs
+func (h *Handler) attachSongListStats(ctx context.Context, songs []models.Song) error {
+	ptrs := make([]*models.Song, len(songs))
+	for i := range songs {
+		ptrs[i] = &songs[i]
+	}
+	return h.Songs.AttachStats(ctx, ptrs...)
+}
+
+// FavouriteAlbum adds an album the user can read to their favourites
+func (h *Handler) FavouriteAlbum(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	favourite := models.AlbumFavourite{UserID: c.MustGet("userID").(uint), AlbumID: album.ID}
+	if err := h.db(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&favourite).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Album added to favourites"})
+}
+
+// UnfavouriteAlbum removes an album from the user's favourites
+func (h *Handler) UnfavouriteAlbum(c *gin.Context) {
+	if err := h.db(c).Where("user_id = ? AND album_id = ?", c.MustGet("userID"), c.Param("id")).
+		Delete(&models.AlbumFavourite{}).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Album removed from favourites"})
+}
+
+// LikeSong likes a song of an album the user can read
+func (h *Handler) LikeSong(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	songID, ok := parseID(c.Param("songId"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "musique non trouvée"})
+		return
+	}
+	song, err := h.Songs.FindInAlbum(c.Request.Context(), album.ID, songID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "musique non trouvée"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	like := models.SongLike{UserID: c.MustGet("userID").(uint), SongID: song.ID}
+	if err := h.db(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&like).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Song liked"})
+}
+
+// UnlikeSong removes the user's like from a song
+func (h *Handler) UnlikeSong(c *gin.Context) {
+	if err := h.db(c).Where("user_id = ? AND song_id = ?", c.MustGet("userID"), c.Param("songId")).
+		Delete(&models.SongLike{}).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Song unliked"})
+}
+
+// RateAlbum sets the user's 1 to 5 rating of an album, replacing any previous rating
+func (h *Handler) RateAlbum(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var ratingInput struct {
+		Score int `json:"score" binding:"required,min=1,max=5"`
+	}
+
+	if err := c.BindJSON(&ratingInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rating := models.AlbumRating{UserID: c.MustGet("userID").(uint), AlbumID: album.ID, Score: ratingInput.Score}
+	if err := h.db(c).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "album_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"score", "updated_at"}),
+	}).Create(&rating).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A new rating replaces the previous one in the feed
+	h.db(c).Where("type = ? AND user_id = ? AND album_id = ?", models.ActivityAlbumRated, rating.UserID, album.ID).
+		Delete(&models.Activity{})
+	recordActivity(h.db(c), models.Activity{
+		Type:    models.ActivityAlbumRated,
+		UserID:  rating.UserID,
+		AlbumID: &album.ID,
+		Score:   rating.Score,
+	})
+
+	if err := h.Albums.AttachStats(c.Request.Context(), album); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"score":          rating.Score,
+		"average_rating": album.AverageRating,
+		"rating_count":   album.RatingCount,
+	})
+}
+
+// DeleteAlbumRating removes the user's rating of an album
+func (h *Handler) DeleteAlbumRating(c *gin.Context) {
+	if err := h.db(c).Where("user_id = ? AND album_id = ?", c.MustGet("userID"), c.Param("id")).
+		Delete(&models.AlbumRating{}).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.db(c).Where("type = ? AND user_id = ? AND album_id = ?", models.ActivityAlbumRated, c.MustGet("userID"), c.Param("id")).
+		Delete(&models.Activity{})
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Rating removed"})
+}
+
+// GetFavouriteAlbums lists the user's favourite albums that are still visible to them
+func (h *Handler) GetFavouriteAlbums(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var albums []models.Album
+	favourites := h.db(c).Model(&models.AlbumFavourite{}).Select("album_id").Where("user_id = ?", userID)
+	if err := repository.VisibleAlbums(h.db(c).Preload("User", repository.PublicUser).Preload("Tags"), userID).
+		Where("albums.id IN (?)", favourites).Find(&albums).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.attachAlbumListStats(c.Request.Context(), albums); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, albums)
+}
+
+// GetLikedSongs lists the songs the user likes whose album is still visible to them
+func (h *Handler) GetLikedSongs(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var songs []models.Song
+	likes := h.db(c).Model(&models.SongLike{}).Select("song_id").Where("user_id = ?", userID)
+	visible := repository.VisibleAlbums(h.db(c).Model(&models.Album{}).Select("albums.id"), userID)
+	if err := h.db(c).Where("id IN (?) AND album_id IN (?)", likes, visible).Find(&songs).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.attachSongListStats(c.Request.Context(), songs); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, songs)
+}
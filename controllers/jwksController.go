@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"net/http"
+
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public keys used to verify tokens
+func (h *Handler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
+}
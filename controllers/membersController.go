@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+func isValidMemberRole(role string) bool {
+	return role == models.RoleViewer || role == models.RoleEditor || role == models.RoleOwner
+}
+
+// GetAlbumMembers lists the creator and members of an album. Only members can see the list.
+func (h *Handler) GetAlbumMembers(c *gin.Context) {
+	album, role, ok := h.findAlbum(c, repository.WithOwner, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+	if role == "" {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Only members can see the members of this album"})
+		return
+	}
+
+	var members []models.AlbumMember
+	if err := h.db(c).Preload("User", repository.PublicUser).Where("album_id = ?", album.ID).Find(&members).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"owner":   album.User,
+		"members": members,
+	})
+}
+
+// InviteAlbumMember invites someone by email to join the album with a role
+func (h *Handler) InviteAlbumMember(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithOwnerAccount, c.Param("id"), models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Email string `json:"email" binding:"required,email"`
+		Role  string `json:"role" binding:"required"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isValidMemberRole(body.Role) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "role must be 'viewer', 'editor' or 'owner'"})
+		return
+	}
+
+	if strings.EqualFold(body.Email, album.User.Email) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "The album creator is already its owner"})
+		return
+	}
+
+	var existing int64
+	h.db(c).Model(&models.AlbumMember{}).
+		Joins("JOIN users ON users.id = album_members.user_id").
+		Where("album_members.album_id = ? AND users.email = ?", album.ID, body.Email).
+		Count(&existing)
+	if existing > 0 {
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "This user is already a member of the album"})
+		return
+	}
+
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating invitation"})
+		return
+	}
+
+	inviter := c.MustGet("userID").(uint)
+	invitation := models.AlbumInvitation{
+		Email:       body.Email,
+		Role:        body.Role,
+		TokenHash:   utils.HashToken(token),
+		ExpiresAt:   time.Now().Add(invitationTTL),
+		AlbumID:     album.ID,
+		InvitedByID: inviter,
+	}
+	if err := h.db(c).Create(&invitation).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	mailBody := fmt.Sprintf("Hello,\n\nYou have been invited to collaborate on the album \"%s\" as %s.\nLog in (or create an account with this email address) and accept the invitation with POST %s/invitations/accept using the token below:\n\n%s\n\nThis invitation expires in %s.\n", album.Title, body.Role, appURL(), token, invitationTTL)
+	if err := h.Mailer.Send(body.Email, "Invitation to collaborate on "+album.Title, mailBody); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error sending invitation email", "email", body.Email, "error", err)
+	}
+
+	c.IndentedJSON(http.StatusCreated, invitation)
+}
+
+// GetAlbumInvitations lists the pending invitations of an album
+func (h *Handler) GetAlbumInvitations(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var invitations []models.AlbumInvitation
+	if err := h.db(c).Where("album_id = ? AND accepted_at IS NULL AND expires_at > ?", album.ID, time.Now()).
+		Order("created_at DESC").Find(&invitations).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, invitations)
+}
+
+// RevokeAlbumInvitation cancels a pending invitation
+func (h *Handler) RevokeAlbumInvitation(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	result := h.db(c).Where("id = ? AND album_id = ? AND accepted_at IS NULL", c.Param("invitationId"), album.ID).
+		Delete(&models.AlbumInvitation{})
+	if result.Error != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// AcceptInvitation makes the authenticated user a member of the album they were invited to.
+// The invitation must have been sent to the user's verified email address.
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var invitation models.AlbumInvitation
+	if err := h.db(c).Where("token_hash = ?", utils.HashToken(body.Token)).First(&invitation).Error; err != nil ||
+		invitation.AcceptedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+
+	if !strings.EqualFold(invitation.Email, user.Email) || !user.IsEmailVerified() {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "This invitation was sent to another email address"})
+		return
+	}
+
+	var member models.AlbumMember
+	err := h.db(c).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AlbumInvitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidUserToken
+		}
+
+		err := tx.Where("album_id = ? AND user_id = ?", invitation.AlbumID, user.ID).First(&member).Error
+		if err == gorm.ErrRecordNotFound {
+			member = models.AlbumMember{AlbumID: invitation.AlbumID, UserID: user.ID, Role: invitation.Role}
+			return tx.Create(&member).Error
+		}
+		if err != nil {
+			return err
+		}
+		member.Role = invitation.Role
+		return tx.Save(&member).Error
+	})
+	if err != nil {
+		if err == errInvalidUserToken {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, member)
+}
+
+// UpdateAlbumMember changes the role of a member
+func (h *Handler) UpdateAlbumMember(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isValidMemberRole(body.Role) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "role must be 'viewer', 'editor' or 'owner'"})
+		return
+	}
+
+	var member models.AlbumMember
+	if err := h.db(c).Where("album_id = ? AND user_id = ?", album.ID, c.Param("userId")).First(&member).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "member not found"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db(c).Model(&member).Update("role", body.Role).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, member)
+}
+
+// RemoveAlbumMember removes a member from an album. Owners can remove anyone
+// and members can remove themselves to leave the album.
+func (h *Handler) RemoveAlbumMember(c *gin.Context) {
+	album, role, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	if role != models.RoleOwner && c.Param("userId") != fmt.Sprint(userID) {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "You need the owner role on this album"})
+		return
+	}
+
+	// Members are hard deleted so the user can be invited again
+	result := h.db(c).Unscoped().Where("album_id = ? AND user_id = ?", album.ID, c.Param("userId")).Delete(&models.AlbumMember{})
+	if result.Error != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
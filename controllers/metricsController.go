@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMetrics returns the server's cache statistics and the state of the circuit
+// breakers of external services. Only admins can read them.
+func (h *Handler) GetMetrics(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.IsAdmin {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Only admins can read metrics"})
+		return
+	}
+
+	metrics := gin.H{
+		"youtube_cache": h.VideoInfo.Stats(),
+	}
+	if transport, ok := utils.HTTPClient.Transport.(*utils.ResilientTransport); ok {
+		metrics["circuit_breakers"] = transport.CircuitStates()
+	}
+	c.IndentedJSON(http.StatusOK, metrics)
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie   = "oidc_state"
+	oidcStateAudience = "oidc-state"
+	oidcStateTTL      = 10 * time.Minute
+)
+
+var errIdentityConflict = errors.New("an account with this email already exists and the provider did not verify the address")
+
+// oidcStateClaims carries the state, nonce and PKCE verifier between the
+// login redirect and the callback in a signed, short-lived cookie
+type oidcStateClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// OIDCLogin redirects the user to the external identity provider
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	if h.OIDC == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+		return
+	}
+
+	state, errState := utils.GenerateRandomToken()
+	nonce, errNonce := utils.GenerateRandomToken()
+	verifier, challenge, errPKCE := utils.NewPKCEVerifier()
+	if errState != nil || errNonce != nil || errPKCE != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating login state"})
+		return
+	}
+
+	cookie, err := utils.SignClaims(&oidcStateClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcStateAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+		},
+	})
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating login state"})
+		return
+	}
+
+	authURL, err := h.OIDC.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, cookie, int(oidcStateTTL.Seconds()), "/auth/oidc", "", strings.HasPrefix(h.OIDC.RedirectURL, "https://"), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes the login, links the identity to a user and issues the app token
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	if h.OIDC == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Identity provider error: " + providerErr})
+		return
+	}
+
+	rawState, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Login session missing or expired"})
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", false, true)
+
+	var stateClaims oidcStateClaims
+	if err := utils.ParseClaims(rawState, &stateClaims); err != nil || len(stateClaims.Audience) != 1 || stateClaims.Audience[0] != oidcStateAudience {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Login session missing or expired"})
+		return
+	}
+	if c.Query("state") == "" || c.Query("state") != stateClaims.State {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid state parameter"})
+		return
+	}
+
+	claims, err := h.OIDC.Exchange(c.Request.Context(), c.Query("code"), stateClaims.Verifier, stateClaims.Nonce)
+	if err != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.linkOIDCIdentity(c.Request.Context(), h.OIDC.IssuerURL, claims)
+	if err != nil {
+		if err == errIdentityConflict {
+			c.IndentedJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Email, user.TokenVersion)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	// Browser flows hand the token to the frontend in the URL fragment
+	if redirect := os.Getenv("OIDC_POST_LOGIN_REDIRECT"); redirect != "" {
+		c.Redirect(http.StatusFound, redirect+"#token="+url.QueryEscape(token))
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"user":  userResponse(user),
+		"token": token,
+	})
+}
+
+// linkOIDCIdentity returns the user linked to the external identity. Unknown identities
+// are linked to the account with the same email when the provider verified it, or to
+// a new account otherwise. An unverified account is claimed by the identity.
+func (h *Handler) linkOIDCIdentity(ctx context.Context, issuer string, claims *utils.IDTokenClaims) (*models.User, error) {
+	var user models.User
+	err := h.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&user, identity.UserID).Error
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		if claims.Email == "" {
+			return errors.New("the identity provider did not return an email address")
+		}
+
+		err = tx.Where("email = ?", claims.Email).First(&user).Error
+		switch {
+		case err == nil:
+			if !claims.EmailVerified {
+				return errIdentityConflict
+			}
+			if user.EmailVerifiedAt == nil {
+				if err := claimUnverifiedAccount(tx, &user); err != nil {
+					return err
+				}
+			}
+		case err == gorm.ErrRecordNotFound:
+			if user, err = createOIDCUser(tx, claims); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			Issuer:  issuer,
+			Subject: claims.Subject,
+			Email:   claims.Email,
+			UserID:  user.ID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// claimUnverifiedAccount hands an account whose address was never verified over to
+// the owner of the address. Anyone may have registered it with someone else's email,
+// so its password and pending tokens are revoked before the identity is linked.
+func claimUnverifiedAccount(tx *gorm.DB, user *models.User) error {
+	randomPassword, err := utils.GenerateRandomToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tokenVersion := user.TokenVersion + 1
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":          string(hashedPassword),
+		"token_version":     tokenVersion,
+		"email_verified_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserToken{}).Error; err != nil {
+		return err
+	}
+
+	user.Password = string(hashedPassword)
+	user.TokenVersion = tokenVersion
+	user.EmailVerifiedAt = &now
+	return nil
+}
+
+// createOIDCUser creates an account for a new external identity. The random
+// password cannot be used to log in until the user resets it.
+func createOIDCUser(tx *gorm.DB, claims *utils.IDTokenClaims) (models.User, error) {
+	randomPassword, err := utils.GenerateRandomToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Email:    claims.Email,
+		Password: string(hashedPassword),
+		Name:     claims.Name,
+	}
+	if claims.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	err = tx.Create(&user).Error
+	return user, err
+}
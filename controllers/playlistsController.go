@@ -0,0 +1,425 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxWatchVideosIDs is the number of videos YouTube accepts in a watch_videos URL
+const maxWatchVideosIDs = 50
+
+// findPlaylist loads a playlist owned by the authenticated user
+func (h *Handler) findPlaylist(c *gin.Context, id string) (*models.Playlist, bool) {
+	var playlist models.Playlist
+	if err := h.db(c).Where("id = ? AND user_id = ?", id, c.MustGet("userID")).First(&playlist).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+			return nil, false
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &playlist, true
+}
+
+// loadPlaylistEntries returns the entries of a playlist in order, skipping songs
+// whose album is no longer visible to the user
+func (h *Handler) loadPlaylistEntries(ctx context.Context, playlistID, userID uint) ([]models.PlaylistEntry, error) {
+	db := h.DB.WithContext(ctx)
+	var entries []models.PlaylistEntry
+	visible := repository.VisibleAlbums(db.Model(&models.Album{}).Select("albums.id"), userID)
+	err := db.Preload("Song").
+		Joins("JOIN songs ON songs.id = playlist_entries.song_id").
+		Where("playlist_entries.playlist_id = ? AND songs.album_id IN (?)", playlistID, visible).
+		Order("playlist_entries.position").
+		Find(&entries).Error
+	return entries, err
+}
+
+// GetPlaylists lists the authenticated user's playlists
+func (h *Handler) GetPlaylists(c *gin.Context) {
+	var playlists []models.Playlist
+	if err := h.db(c).Where("user_id = ?", c.MustGet("userID")).Order("name").Find(&playlists).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, playlists)
+}
+
+// GetPlaylistByID returns a playlist with its songs in order
+func (h *Handler) GetPlaylistByID(c *gin.Context) {
+	playlist, ok := h.findPlaylist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	entries, err := h.loadPlaylistEntries(c.Request.Context(), playlist.ID, playlist.UserID)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	playlist.Entries = entries
+
+	c.IndentedJSON(http.StatusOK, playlist)
+}
+
+// CreatePlaylist creates an empty playlist
+func (h *Handler) CreatePlaylist(c *gin.Context) {
+	var playlistInput struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.BindJSON(&playlistInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	playlist := models.Playlist{
+		Name:        playlistInput.Name,
+		Description: playlistInput.Description,
+		UserID:      c.MustGet("userID").(uint),
+	}
+
+	if err := h.db(c).Create(&playlist).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, playlist)
+}
+
+// UpdatePlaylist renames a playlist or changes its description
+func (h *Handler) UpdatePlaylist(c *gin.Context) {
+	playlist, ok := h.findPlaylist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var playlistInput struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	if err := c.BindJSON(&playlistInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if playlistInput.Name != nil {
+		if *playlistInput.Name == "" {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+		updates["name"] = *playlistInput.Name
+	}
+	if playlistInput.Description != nil {
+		updates["description"] = *playlistInput.Description
+	}
+
+	if len(updates) > 0 {
+		if err := h.db(c).Model(playlist).Updates(updates).Error; err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, playlist)
+}
+
+// DeletePlaylist deletes a playlist and its entries; the songs themselves are kept
+func (h *Handler) DeletePlaylist(c *gin.Context) {
+	playlist, ok := h.findPlaylist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	err := h.db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("playlist_id = ?", playlist.ID).Delete(&models.PlaylistEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(playlist).Error
+	})
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Playlist deleted"})
+}
+
+// AddSongToPlaylist inserts a song the user can read at a position, or at the end when no position is given
+func (h *Handler) AddSongToPlaylist(c *gin.Context) {
+	playlist, ok := h.findPlaylist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var entryInput struct {
+		SongID   uint `json:"song_id" binding:"required"`
+		Position *int `json:"position"`
+	}
+
+	if err := c.BindJSON(&entryInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var song models.Song
+	err := h.db(c).Joins("JOIN albums ON albums.id = songs.album_id").
+		Scopes(func(db *gorm.DB) *gorm.DB { return repository.VisibleAlbums(db, playlist.UserID) }).
+		Where("songs.id = ?", entryInput.SongID).First(&song).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "musique non trouvée"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry := models.PlaylistEntry{PlaylistID: playlist.ID, SongID: song.ID, Song: song}
+	err = h.db(c).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.PlaylistEntry{}).Where("playlist_id = ?", playlist.ID).Count(&count).Error; err != nil {
+			return err
+		}
+
+		entry.Position = int(count)
+		if entryInput.Position != nil && *entryInput.Position >= 0 && *entryInput.Position < int(count) {
+			entry.Position = *entryInput.Position
+			if err := tx.Model(&models.PlaylistEntry{}).
+				Where("playlist_id = ? AND position >= ?", playlist.ID, entry.Position).
+				Update("position", gorm.Expr("position + 1")).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Omit("Song").Create(&entry).Error
+	})
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, entry)
+}
+
+// RemoveSongFromPlaylist removes an entry and closes the gap in positions
+func (h *Handler) RemoveSongFromPlaylist(c *gin.Context) {
+	playlist, ok := h.findPlaylist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	err := h.db(c).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND playlist_id = ?", c.Param("entryId"), playlist.ID).Delete(&models.PlaylistEntry{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return repository.CompactPlaylist(tx, playlist.ID)
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "playlist entry not found"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Song removed from playlist"})
+}
+
+// MovePlaylistEntry moves an entry to a new position, shifting the entries in between
+func (h *Handler) MovePlaylistEntry(c *gin.Context) {
+	playlist, ok := h.findPlaylist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var moveInput struct {
+		Position *int `json:"position" binding:"required"`
+	}
+
+	if err := c.BindJSON(&moveInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entry models.PlaylistEntry
+	if err := h.db(c).Where("id = ? AND playlist_id = ?", c.Param("entryId"), playlist.ID).First(&entry).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "playlist entry not found"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.db(c).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.PlaylistEntry{}).Where("playlist_id = ?", playlist.ID).Count(&count).Error; err != nil {
+			return err
+		}
+
+		target := *moveInput.Position
+		if target < 0 {
+			target = 0
+		}
+		if target >= int(count) {
+			target = int(count) - 1
+		}
+
+		entries := tx.Model(&models.PlaylistEntry{}).Where("playlist_id = ?", playlist.ID)
+		switch {
+		case target < entry.Position:
+			if err := entries.Where("position >= ? AND position < ?", target, entry.Position).
+				Update("position", gorm.Expr("position + 1")).Error; err != nil {
+				return err
+			}
+		case target > entry.Position:
+			if err := entries.Where("position > ? AND position <= ?", entry.Position, target).
+				Update("position", gorm.Expr("position - 1")).Error; err != nil {
+				return err
+			}
+		}
+
+		entry.Position = target
+		return tx.Model(&entry).Update("position", target).Error
+	})
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, entry)
+}
+
+// ReorderPlaylist sets the order of the whole playlist from a list of entry IDs
+func (h *Handler) ReorderPlaylist(c *gin.Context) {
+	playlist, ok := h.findPlaylist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var orderInput struct {
+		EntryIDs []uint `json:"entry_ids" binding:"required"`
+	}
+
+	if err := c.BindJSON(&orderInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ids []uint
+	if err := h.db(c).Model(&models.PlaylistEntry{}).Where("playlist_id = ?", playlist.ID).Pluck("id", &ids).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		existing[id] = true
+	}
+	seen := make(map[uint]bool, len(orderInput.EntryIDs))
+	for _, id := range orderInput.EntryIDs {
+		if !existing[id] || seen[id] {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "entry_ids must list every entry of the playlist exactly once"})
+			return
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(existing) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "entry_ids must list every entry of the playlist exactly once"})
+		return
+	}
+
+	err := h.db(c).Transaction(func(tx *gorm.DB) error {
+		for i, id := range orderInput.EntryIDs {
+			if err := tx.Model(&models.PlaylistEntry{}).Where("id = ?", id).Update("position", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.loadPlaylistEntries(c.Request.Context(), playlist.ID, playlist.UserID)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	playlist.Entries = entries
+
+	c.IndentedJSON(http.StatusOK, playlist)
+}
+
+// ExportPlaylist exports a playlist as a YouTube watch_videos URL (format=youtube)
+// or as an M3U file (format=m3u)
+func (h *Handler) ExportPlaylist(c *gin.Context) {
+	playlist, ok := h.findPlaylist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	entries, err := h.loadPlaylistEntries(c.Request.Context(), playlist.ID, playlist.UserID)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "youtube") {
+	case "youtube":
+		var videoIDs []string
+		for _, entry := range entries {
+			if id, err := utils.ExtractVideoID(entry.Song.YoutubeURL); err == nil {
+				videoIDs = append(videoIDs, id)
+			}
+		}
+
+		truncated := len(videoIDs) > maxWatchVideosIDs
+		if truncated {
+			videoIDs = videoIDs[:maxWatchVideosIDs]
+		}
+
+		c.IndentedJSON(http.StatusOK, gin.H{
+			"url":       "https://www.youtube.com/watch_videos?video_ids=" + strings.Join(videoIDs, ","),
+			"count":     len(videoIDs),
+			"truncated": truncated,
+		})
+	case "m3u":
+		var sb strings.Builder
+		sb.WriteString("#EXTM3U\n")
+		sb.WriteString("#PLAYLIST:" + m3uText(playlist.Name) + "\n")
+		for _, entry := range entries {
+			sb.WriteString(fmt.Sprintf("#EXTINF:-1,%s\n%s\n", m3uText(entry.Song.Title), entry.Song.YoutubeURL))
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"playlist-%d.m3u\"", playlist.ID))
+		c.Data(http.StatusOK, "audio/x-mpegurl; charset=utf-8", []byte(sb.String()))
+	default:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "format must be 'youtube' or 'm3u'"})
+	}
+}
+
+// m3uText keeps a value on a single line so it cannot break the M3U structure
+func m3uText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
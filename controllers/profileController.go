@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Policies for the albums of a deleted account
+const (
+	AlbumPolicyDelete   = "delete"
+	AlbumPolicyReassign = "reassign"
+)
+
+// userResponse is the public representation of a user account
+func userResponse(user *models.User) gin.H {
+	return gin.H{
+		"id":             user.ID,
+		"email":          user.Email,
+		"name":           user.Name,
+		"email_verified": user.IsEmailVerified(),
+		"is_admin":       user.IsAdmin,
+	}
+}
+
+// currentUser loads the authenticated user, writing an error response when it fails
+func (h *Handler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	user, err := h.Users.FindByID(c.Request.Context(), userID.(uint))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// UpdateProfile changes the authenticated user's name and/or email.
+// Changing the email requires the current password and a new verification of the address.
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name            *string `json:"name"`
+		Email           *string `json:"email" binding:"omitempty,email"`
+		CurrentPassword string  `json:"current_password"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes := repository.ProfileChanges{Name: body.Name}
+
+	emailChanged := body.Email != nil && *body.Email != user.Email
+	if emailChanged {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.CurrentPassword)); err != nil {
+			c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+
+		if _, err := h.Users.FindByEmail(c.Request.Context(), *body.Email); err == nil {
+			c.IndentedJSON(http.StatusConflict, gin.H{"error": "This email is already in use"})
+			return
+		}
+
+		changes.Email = body.Email
+	}
+
+	if err := h.Users.UpdateProfile(c.Request.Context(), user, changes); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if emailChanged {
+		if err := h.sendVerificationEmail(c.Request.Context(), user); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error sending verification email", "email", user.Email, "error", err)
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, userResponse(user))
+}
+
+// ChangePassword sets a new password after checking the current one.
+// All previously issued tokens are revoked and a fresh token is returned.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=6"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.CurrentPassword)); err != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	if err := h.Users.SetPassword(c.Request.Context(), user, string(hashedPassword)); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Email, user.TokenVersion)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"message": "Password changed",
+		"token":   token,
+	})
+}
+
+// DeleteProfile permanently deletes the authenticated user's account.
+// The user's albums and their songs are either deleted or reassigned to
+// another account depending on album_policy.
+func (h *Handler) DeleteProfile(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Password    string `json:"password" binding:"required"`
+		AlbumPolicy string `json:"album_policy"`
+		ReassignTo  string `json:"reassign_to"`
+	}
+
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)); err != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	if body.AlbumPolicy == "" {
+		body.AlbumPolicy = AlbumPolicyDelete
+	}
+
+	var newOwnerID uint
+	switch body.AlbumPolicy {
+	case AlbumPolicyDelete:
+	case AlbumPolicyReassign:
+		newOwner, err := h.Users.FindByEmail(c.Request.Context(), body.ReassignTo)
+		if err != nil || newOwner.ID == user.ID {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "reassign_to must be the email of another existing user"})
+			return
+		}
+		newOwnerID = newOwner.ID
+	default:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "album_policy must be 'delete' or 'reassign'"})
+		return
+	}
+
+	// Covers of deleted albums are removed from storage once the deletion is committed
+	var coverKeys []string
+	err := h.db(c).Transaction(func(tx *gorm.DB) error {
+		var albumIDs []uint
+		if err := tx.Model(&models.Album{}).Where("user_id = ?", user.ID).Pluck("id", &albumIDs).Error; err != nil {
+			return err
+		}
+		if body.AlbumPolicy == AlbumPolicyDelete {
+			if err := tx.Model(&models.Album{}).Where("id IN ? AND cover_key <> ''", albumIDs).Pluck("cover_key", &coverKeys).Error; err != nil {
+				return err
+			}
+		}
+
+		if body.AlbumPolicy == AlbumPolicyReassign {
+			if err := tx.Model(&models.Album{}).Where("user_id = ?", user.ID).Update("user_id", newOwnerID).Error; err != nil {
+				return err
+			}
+		} else if err := deleteAlbums(tx, albumIDs); err != nil {
+			return err
+		}
+
+		return deleteUserData(tx, user.ID)
+	})
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, key := range coverKeys {
+		h.removeCoverImages(c.Request.Context(), key)
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// deleteAlbums removes albums together with their songs and tag associations
+func deleteAlbums(tx *gorm.DB, albumIDs []uint) error {
+	if len(albumIDs) == 0 {
+		return nil
+	}
+	var songIDs []uint
+	if err := tx.Model(&models.Song{}).Where("album_id IN ?", albumIDs).Pluck("id", &songIDs).Error; err != nil {
+		return err
+	}
+	if err := repository.RemoveSongsFromPlaylists(tx, songIDs); err != nil {
+		return err
+	}
+	if err := tx.Where("song_id IN ?", songIDs).Delete(&models.SongLike{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("album_id IN ?", albumIDs).Delete(&models.AlbumFavourite{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("album_id IN ?", albumIDs).Delete(&models.AlbumRating{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("album_id IN ?", albumIDs).Delete(&models.Song{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("album_id IN ?", albumIDs).Delete(&models.AlbumTrack{}).Error; err != nil {
+		return err
+	}
+	if err := deleteAlbumComments(tx, albumIDs); err != nil {
+		return err
+	}
+	if err := tx.Where("album_id IN ?", albumIDs).Delete(&models.Activity{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("album_id IN ?", albumIDs).Delete(&models.AlbumShare{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("album_id IN ?", albumIDs).Delete(&models.AlbumMember{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("album_id IN ?", albumIDs).Delete(&models.AlbumInvitation{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM album_tags WHERE album_id IN ?", albumIDs).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", albumIDs).Delete(&models.Album{}).Error
+}
+
+// deleteUserData removes the user row and every record that only makes sense for that user.
+// The user is hard deleted so the email address can be registered again.
+func deleteUserData(tx *gorm.DB, userID uint) error {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.APIKey{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("created_by_id = ?", userID).Delete(&models.AlbumShare{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.AlbumMember{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("invited_by_id = ?", userID).Delete(&models.AlbumInvitation{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.AlbumFavourite{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.SongLike{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.AlbumRating{}).Error; err != nil {
+		return err
+	}
+	if err := anonymizeUserComments(tx, userID); err != nil {
+		return err
+	}
+	if err := tx.Where("follower_id = ? OR followed_id = ?", userID, userID).Delete(&models.Follow{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.Activity{}).Error; err != nil {
+		return err
+	}
+
+	playlists := tx.Model(&models.Playlist{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("playlist_id IN (?)", playlists).Delete(&models.PlaylistEntry{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.Playlist{}).Error; err != nil {
+		return err
+	}
+
+	result := tx.Unscoped().Delete(&models.User{}, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateAlbumShare mints a share token giving read access to an album and its songs
+// without an account, whatever the album's visibility. Only its hash is stored, so
+// the token is only returned once.
+func (h *Handler) CreateAlbumShare(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var shareInput struct {
+		Label     string     `json:"label"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := c.BindJSON(&shareInput); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if shareInput.ExpiresAt != nil && shareInput.ExpiresAt.Before(time.Now()) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error generating share token"})
+		return
+	}
+
+	share := models.AlbumShare{
+		Label:       shareInput.Label,
+		TokenHash:   utils.HashToken(token),
+		ExpiresAt:   shareInput.ExpiresAt,
+		AlbumID:     album.ID,
+		CreatedByID: c.MustGet("userID").(uint),
+	}
+
+	if err := h.db(c).Create(&share).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, gin.H{
+		"share": share,
+		"token": token,
+		"url":   appURL() + "/shared/" + token,
+	})
+}
+
+// GetAlbumShares lists the active shares of an album
+func (h *Handler) GetAlbumShares(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var shares []models.AlbumShare
+	if err := h.db(c).Where("album_id = ?", album.ID).Order("created_at DESC").Find(&shares).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, shares)
+}
+
+// RevokeAlbumShare revokes a share; its token stops working immediately
+func (h *Handler) RevokeAlbumShare(c *gin.Context) {
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	result := h.db(c).Where("id = ? AND album_id = ?", c.Param("shareId"), album.ID).Delete(&models.AlbumShare{})
+	if result.Error != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "share not found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Share revoked"})
+}
+
+// GetSharedAlbum returns an album with its songs from a share token, without authentication.
+// Share tokens work for any album until they expire or are revoked.
+func (h *Handler) GetSharedAlbum(c *gin.Context) {
+	var share models.AlbumShare
+	if err := h.db(c).Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", utils.HashToken(c.Param("token")), time.Now()).
+		First(&share).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album not found"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	album, err := h.Albums.FindByID(c.Request.Context(), share.AlbumID, albumDetails)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album not found"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Albums.AttachStats(c.Request.Context(), album); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := attachThumbnailURLs(album); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, album)
+}
@@ -1,28 +1,21 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
-	"example/web-service-gin/initializers"
 	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
 	"example/web-service-gin/utils"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // AddSongToAlbum adds a song to an album from JSON received in the request body
-func AddSongToAlbum(c *gin.Context) {
-	albumID := c.Param("id")
-
-	// Verify that the album exists
-	var album models.Album
-	if err := initializers.DB.First(&album, albumID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album non trouvé"})
-			return
-		}
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+func (h *Handler) AddSongToAlbum(c *gin.Context) {
+	// Only the owner and editors can add songs to an album
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleEditor)
+	if !ok {
 		return
 	}
 
@@ -49,8 +42,12 @@ func AddSongToAlbum(c *gin.Context) {
 		return
 	}
 
-	// Get video information from YouTube
-	videoInfo, err := utils.GetVideoInfoFromURL(songInput.YoutubeURL)
+	// Get video information from YouTube, or from the cache when the video was looked up recently
+	videoInfo, err := h.VideoInfo.GetVideoInfoFromURL(c.Request.Context(), songInput.YoutubeURL)
+	if errors.Is(err, utils.ErrCircuitOpen) {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "YouTube est indisponible, réessayez plus tard"})
+		return
+	}
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Impossible de récupérer les informations depuis YouTube: " + err.Error()})
 		return
@@ -69,33 +66,42 @@ func AddSongToAlbum(c *gin.Context) {
 		ThumbnailURL: videoInfo.ThumbnailURL,
 		ViewCount:    videoInfo.ViewCount,
 		AlbumID:      album.ID,
+
+		YoutubeLikeCount: videoInfo.LikeCount,
+		DurationSeconds:  int(videoInfo.Duration.Seconds()),
+		PublishedAt:      videoInfo.PublishedAt,
 	}
 
-	if err := initializers.DB.Create(&newSong).Error; err != nil {
+	if err := h.Songs.Create(c.Request.Context(), &newSong); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	recordActivity(h.db(c), models.Activity{
+		Type:    models.ActivitySongAdded,
+		UserID:  c.MustGet("userID").(uint),
+		AlbumID: &album.ID,
+		SongID:  &newSong.ID,
+	})
+
 	c.IndentedJSON(http.StatusCreated, newSong)
 }
 
 // GetSongsByAlbum gets all songs for a specific album
-func GetSongsByAlbum(c *gin.Context) {
-	albumID := c.Param("id")
-
-	// Verify that the album exists
-	var album models.Album
-	if err := initializers.DB.First(&album, albumID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "album non trouvé"})
-			return
-		}
+func (h *Handler) GetSongsByAlbum(c *gin.Context) {
+	// Verify that the album exists and is visible to the user
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	songs, err := h.Songs.ListByAlbum(c.Request.Context(), album.ID)
+	if err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var songs []models.Song
-	if err := initializers.DB.Where("album_id = ?", albumID).Find(&songs).Error; err != nil {
+	if err := h.attachSongListStats(c.Request.Context(), songs); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -104,12 +110,21 @@ func GetSongsByAlbum(c *gin.Context) {
 }
 
 // DeleteSong deletes a song by ID
-func DeleteSong(c *gin.Context) {
-	songID := c.Param("songId")
+func (h *Handler) DeleteSong(c *gin.Context) {
+	// Only the owner and editors can remove songs from an album
+	album, _, ok := h.findAlbum(c, repository.WithoutRelations, c.Param("id"), models.RoleEditor)
+	if !ok {
+		return
+	}
 
-	var song models.Song
-	if err := initializers.DB.First(&song, songID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	songID, ok := parseID(c.Param("songId"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "musique non trouvée"})
+		return
+	}
+	song, err := h.Songs.FindInAlbum(c.Request.Context(), album.ID, songID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "musique non trouvée"})
 			return
 		}
@@ -117,7 +132,7 @@ func DeleteSong(c *gin.Context) {
 		return
 	}
 
-	if err := initializers.DB.Delete(&song).Error; err != nil {
+	if err := h.Songs.Delete(c.Request.Context(), song); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
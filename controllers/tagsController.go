@@ -3,17 +3,16 @@ package controllers
 import (
 	"net/http"
 
-	"example/web-service-gin/initializers"
 	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // GetTags retrieves all available tags
-func GetTags(c *gin.Context) {
-	var tags []models.Tag
-	if err := initializers.DB.Find(&tags).Error; err != nil {
+func (h *Handler) GetTags(c *gin.Context) {
+	tags, err := h.Tags.List(c.Request.Context())
+	if err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -21,7 +20,7 @@ func GetTags(c *gin.Context) {
 }
 
 // CreateTag creates a new tag
-func CreateTag(c *gin.Context) {
+func (h *Handler) CreateTag(c *gin.Context) {
 	var tagInput struct {
 		Name string `json:"name" binding:"required"`
 	}
@@ -32,11 +31,10 @@ func CreateTag(c *gin.Context) {
 	}
 
 	// Check if tag already exists
-	var existingTag models.Tag
-	if err := initializers.DB.Where("name = ?", tagInput.Name).First(&existingTag).Error; err == nil {
+	if _, err := h.Tags.FindByName(c.Request.Context(), tagInput.Name); err == nil {
 		c.IndentedJSON(http.StatusConflict, gin.H{"error": "This tag already exists"})
 		return
-	} else if err != gorm.ErrRecordNotFound {
+	} else if err != repository.ErrNotFound {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -45,11 +43,17 @@ func CreateTag(c *gin.Context) {
 		Name: tagInput.Name,
 	}
 
-	if err := initializers.DB.Create(&newTag).Error; err != nil {
+	if err := h.Tags.Create(c.Request.Context(), &newTag); err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	recordActivity(h.db(c), models.Activity{
+		Type:   models.ActivityTagCreated,
+		UserID: c.MustGet("userID").(uint),
+		TagID:  &newTag.ID,
+	})
+
 	c.IndentedJSON(http.StatusCreated, newTag)
 }
 
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	thumbnailTokenAudience = "song-thumbnail"
+	thumbnailTokenTTL      = 2 * time.Hour
+)
+
+// thumbnailClaims grant access to the thumbnails of an album's songs. They are put in
+// the thumbnail URLs, since <img> tags cannot send the Authorization header.
+type thumbnailClaims struct {
+	AlbumID uint `json:"album_id"`
+	jwt.RegisteredClaims
+}
+
+// thumbnailHosts are the YouTube image hosts the thumbnail proxy fetches from
+var thumbnailHosts = map[string]bool{
+	"i.ytimg.com":     true,
+	"i1.ytimg.com":    true,
+	"i2.ytimg.com":    true,
+	"i3.ytimg.com":    true,
+	"i4.ytimg.com":    true,
+	"img.youtube.com": true,
+}
+
+// songThumbnailURL returns the stored thumbnail URL when it points to YouTube, and
+// otherwise the standard thumbnail of the video. Other hosts are never fetched,
+// since thumbnail URLs can be set by imports.
+func songThumbnailURL(song *models.Song) (string, bool) {
+	if u, err := url.Parse(song.ThumbnailURL); err == nil && u.Scheme == "https" && thumbnailHosts[strings.ToLower(u.Hostname())] {
+		return song.ThumbnailURL, true
+	}
+	videoID, err := utils.ExtractVideoID(song.YoutubeURL)
+	if err != nil {
+		return "", false
+	}
+	return "https://i.ytimg.com/vi/" + videoID + "/hqdefault.jpg", true
+}
+
+// attachThumbnailURLs sets the signed cached thumbnail URLs of the album's songs.
+// Expiry is rounded to the hour so the URLs, and the browser's cached images, stay
+// the same for at least an hour.
+func attachThumbnailURLs(album *models.Album) error {
+	var token string
+	for i := range album.Songs {
+		song := &album.Songs[i]
+		if _, ok := songThumbnailURL(song); !ok {
+			continue
+		}
+		if token == "" {
+			var err error
+			token, err = utils.SignClaims(&thumbnailClaims{
+				AlbumID: album.ID,
+				RegisteredClaims: jwt.RegisteredClaims{
+					Audience:  jwt.ClaimStrings{thumbnailTokenAudience},
+					ExpiresAt: jwt.NewNumericDate(time.Now().Truncate(time.Hour).Add(thumbnailTokenTTL)),
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		song.CachedThumbnailURL = fmt.Sprintf("/songs/%d/thumbnail?token=%s", song.ID, url.QueryEscape(token))
+	}
+	return nil
+}
+
+// GetSongThumbnail serves a song's YouTube thumbnail from the server's cache, so
+// browsers never contact YouTube to display it. The token query parameter comes
+// from the song's cached_thumbnail_url in the album details. Clients can revalidate
+// with If-None-Match or If-Modified-Since.
+func (h *Handler) GetSongThumbnail(c *gin.Context) {
+	var claims thumbnailClaims
+	if err := utils.ParseClaims(c.Query("token"), &claims); err != nil || len(claims.Audience) != 1 || claims.Audience[0] != thumbnailTokenAudience {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Invalid or expired thumbnail link"})
+		return
+	}
+
+	songID, ok := parseID(c.Param("id"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "song not found"})
+		return
+	}
+	song, err := h.Songs.FindByID(c.Request.Context(), songID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "song not found"})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if song.AlbumID != claims.AlbumID {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Invalid or expired thumbnail link"})
+		return
+	}
+
+	thumbnailURL, ok := songThumbnailURL(song)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "This song has no thumbnail"})
+		return
+	}
+
+	thumbnail, err := h.Thumbnails.Get(c.Request.Context(), thumbnailURL)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch the thumbnail"})
+		return
+	}
+
+	defer thumbnail.File.Close()
+
+	c.Header("Content-Type", thumbnail.ContentType)
+	c.Header("ETag", thumbnail.ETag)
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	// ServeContent answers conditional requests with 304 Not Modified
+	http.ServeContent(c.Writer, c.Request, "", thumbnail.LastModified, thumbnail.File)
+}
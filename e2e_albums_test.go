@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"example/web-service-gin/models"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// albumResponse holds the album fields checked by the tests
+type albumResponse struct {
+	ID          uint              `json:"id"`
+	Title       string            `json:"title"`
+	Artist      string            `json:"artist"`
+	Visibility  string            `json:"visibility"`
+	MBID        string            `json:"mbid"`
+	Label       string            `json:"label"`
+	CoverImages map[string]string `json:"cover_images"`
+	Tags        []struct {
+		ID   uint   `json:"id"`
+		Name string `json:"name"`
+	} `json:"tags"`
+	Songs []struct {
+		ID                 uint   `json:"id"`
+		Title              string `json:"title"`
+		CachedThumbnailURL string `json:"cached_thumbnail_url"`
+	} `json:"songs"`
+	Tracks []struct {
+		Position int    `json:"position"`
+		Title    string `json:"title"`
+	} `json:"tracks"`
+}
+
+// albumTitles returns the titles of a list of albums
+func albumTitles(albums []albumResponse) []string {
+	titles := make([]string, len(albums))
+	for i, album := range albums {
+		titles[i] = album.Title
+	}
+	return titles
+}
+
+func hasTitle(albums []albumResponse, title string) bool {
+	for _, album := range albums {
+		if album.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAlbums(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+
+	app.do(http.MethodPost, "/albums", alice.Token, gin.H{"title": "Hidden", "visibility": "secret"}, http.StatusBadRequest)
+	private := app.createAlbum(alice, "Private", "private")
+	unlisted := app.createAlbum(alice, "Unlisted", "unlisted")
+	public := app.createAlbum(alice, "Public", "public")
+
+	own := decode[[]albumResponse](t, app.do(http.MethodGet, "/albums", alice.Token, nil, http.StatusOK))
+	if len(own) != 3 {
+		t.Errorf("alice owns %v", albumTitles(own))
+	}
+	if own := decode[[]albumResponse](t, app.do(http.MethodGet, "/albums", bob.Token, nil, http.StatusOK)); len(own) != 0 {
+		t.Errorf("bob owns %v", albumTitles(own))
+	}
+
+	// Bob browses public albums only, including the seed albums of the admin
+	browsed := decode[[]albumResponse](t, app.do(http.MethodGet, "/all-albums", bob.Token, nil, http.StatusOK))
+	if !hasTitle(browsed, "Public") || !hasTitle(browsed, "Blue Train") || hasTitle(browsed, "Private") || hasTitle(browsed, "Unlisted") {
+		t.Errorf("bob browses %v", albumTitles(browsed))
+	}
+
+	app.do(http.MethodGet, fmt.Sprintf("/albums/%d", private), alice.Token, nil, http.StatusOK)
+	app.do(http.MethodGet, fmt.Sprintf("/albums/%d", private), bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodGet, fmt.Sprintf("/albums/%d", unlisted), bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodGet, fmt.Sprintf("/albums/%d", public), bob.Token, nil, http.StatusOK)
+	app.do(http.MethodGet, "/albums/9999", alice.Token, nil, http.StatusNotFound)
+
+	// Only the owner can change an album
+	app.do(http.MethodPatch, fmt.Sprintf("/albums/%d", public), bob.Token, gin.H{"title": "Stolen"}, http.StatusForbidden)
+	app.do(http.MethodPatch, fmt.Sprintf("/albums/%d", private), bob.Token, gin.H{"title": "Stolen"}, http.StatusNotFound)
+	app.do(http.MethodPatch, fmt.Sprintf("/albums/%d", private), alice.Token, gin.H{"visibility": "everyone"}, http.StatusBadRequest)
+	updated := decode[albumResponse](t, app.do(http.MethodPatch, fmt.Sprintf("/albums/%d", private), alice.Token,
+		gin.H{"title": "Now Public", "artist": "Alice", "visibility": "public"}, http.StatusOK))
+	if updated.Title != "Now Public" || updated.Artist != "Alice" || updated.Visibility != "public" {
+		t.Errorf("unexpected update %+v", updated)
+	}
+	app.do(http.MethodGet, fmt.Sprintf("/albums/%d", private), bob.Token, nil, http.StatusOK)
+}
+
+func TestPublicAlbums(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	private := app.createAlbum(alice, "Private", "private")
+	public := app.createAlbum(alice, "Public", "public")
+	app.addSong(alice, public, "dQw4w9WgXcQ")
+
+	albums := decode[[]albumResponse](t, app.do(http.MethodGet, "/public/albums", "", nil, http.StatusOK))
+	if !hasTitle(albums, "Public") || hasTitle(albums, "Private") {
+		t.Errorf("public albums %v", albumTitles(albums))
+	}
+
+	album := decode[albumResponse](t, app.do(http.MethodGet, fmt.Sprintf("/public/albums/%d", public), "", nil, http.StatusOK))
+	if len(album.Songs) != 1 {
+		t.Errorf("public album has %d songs, want 1", len(album.Songs))
+	}
+	app.do(http.MethodGet, fmt.Sprintf("/public/albums/%d", private), "", nil, http.StatusNotFound)
+}
+
+func TestAlbumShares(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	private := app.createAlbum(alice, "Private", "private")
+	path := fmt.Sprintf("/albums/%d/shares", private)
+
+	app.do(http.MethodPost, path, bob.Token, gin.H{"label": "stolen"}, http.StatusNotFound)
+	app.do(http.MethodPost, path, alice.Token, gin.H{"expires_at": "2000-01-01T00:00:00Z"}, http.StatusBadRequest)
+
+	// Shares open private albums too
+	share := decode[struct {
+		Share struct {
+			ID uint `json:"id"`
+		} `json:"share"`
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}](t, app.do(http.MethodPost, path, alice.Token, gin.H{"label": "friends"}, http.StatusCreated))
+	if !strings.HasSuffix(share.URL, "/shared/"+share.Token) {
+		t.Errorf("unexpected share link %q", share.URL)
+	}
+	album := decode[albumResponse](t, app.do(http.MethodGet, "/shared/"+share.Token, "", nil, http.StatusOK))
+	if album.ID != private {
+		t.Errorf("share link opened album %d, want %d", album.ID, private)
+	}
+	app.do(http.MethodGet, "/shared/unknown", "", nil, http.StatusNotFound)
+
+	// Expired shares stop working
+	expiring := decode[struct {
+		Share struct {
+			ID uint `json:"id"`
+		} `json:"share"`
+		Token string `json:"token"`
+	}](t, app.do(http.MethodPost, path, alice.Token, gin.H{"expires_at": time.Now().Add(time.Hour)}, http.StatusCreated))
+	app.do(http.MethodGet, "/shared/"+expiring.Token, "", nil, http.StatusOK)
+	app.handler.DB.Model(&models.AlbumShare{}).Where("id = ?", expiring.Share.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	app.do(http.MethodGet, "/shared/"+expiring.Token, "", nil, http.StatusNotFound)
+
+	shares := decode[[]map[string]interface{}](t, app.do(http.MethodGet, path, alice.Token, nil, http.StatusOK))
+	if len(shares) != 2 || (shares[0]["label"] != "friends" && shares[1]["label"] != "friends") {
+		t.Errorf("unexpected shares %v", shares)
+	}
+	app.do(http.MethodGet, path, bob.Token, nil, http.StatusNotFound)
+
+	app.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, share.Share.ID), bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, share.Share.ID), alice.Token, nil, http.StatusOK)
+	app.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, share.Share.ID), alice.Token, nil, http.StatusNotFound)
+	app.do(http.MethodGet, "/shared/"+share.Token, "", nil, http.StatusNotFound)
+}
+
+func TestAlbumMembers(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	carol := app.newUser("carol")
+	albumID := app.createAlbum(alice, "Together", "private")
+	album := fmt.Sprintf("/albums/%d", albumID)
+
+	app.do(http.MethodPost, album+"/invitations", alice.Token, gin.H{"email": bob.Email, "role": "admin"}, http.StatusBadRequest)
+	app.do(http.MethodPost, album+"/invitations", alice.Token, gin.H{"email": alice.Email, "role": "editor"}, http.StatusBadRequest)
+	app.do(http.MethodPost, album+"/invitations", carol.Token, gin.H{"email": carol.Email, "role": "owner"}, http.StatusNotFound)
+	app.do(http.MethodPost, album+"/invitations", alice.Token, gin.H{"email": bob.Email, "role": "editor"}, http.StatusCreated)
+	token := app.mailer.token(t, bob.Email)
+
+	invitations := decode[[]map[string]interface{}](t, app.do(http.MethodGet, album+"/invitations", alice.Token, nil, http.StatusOK))
+	if len(invitations) != 1 || invitations[0]["email"] != bob.Email {
+		t.Errorf("unexpected invitations %v", invitations)
+	}
+
+	// Only the invited address can accept the invitation, once
+	app.do(http.MethodPost, "/invitations/accept", carol.Token, gin.H{"token": token}, http.StatusForbidden)
+	app.do(http.MethodPost, "/invitations/accept", bob.Token, gin.H{"token": "invalid"}, http.StatusBadRequest)
+	app.do(http.MethodPost, "/invitations/accept", bob.Token, gin.H{"token": token}, http.StatusOK)
+	app.do(http.MethodPost, "/invitations/accept", bob.Token, gin.H{"token": token}, http.StatusBadRequest)
+	app.do(http.MethodPost, album+"/invitations", alice.Token, gin.H{"email": bob.Email, "role": "viewer"}, http.StatusConflict)
+
+	// Editors can read the album and add songs, but not change its visibility
+	app.do(http.MethodGet, album, bob.Token, nil, http.StatusOK)
+	app.addSong(bob, albumID, "dQw4w9WgXcQ")
+	app.do(http.MethodPatch, album, bob.Token, gin.H{"title": "Renamed"}, http.StatusOK)
+	app.do(http.MethodPatch, album, bob.Token, gin.H{"visibility": "public"}, http.StatusForbidden)
+	app.do(http.MethodGet, album+"/invitations", bob.Token, nil, http.StatusForbidden)
+	app.do(http.MethodGet, album+"/members", carol.Token, nil, http.StatusNotFound)
+
+	members := decode[struct {
+		Owner struct {
+			ID uint `json:"id"`
+		} `json:"owner"`
+		Members []struct {
+			UserID uint   `json:"user_id"`
+			Role   string `json:"role"`
+		} `json:"members"`
+	}](t, app.do(http.MethodGet, album+"/members", bob.Token, nil, http.StatusOK))
+	if members.Owner.ID != alice.ID || len(members.Members) != 1 || members.Members[0].UserID != bob.ID || members.Members[0].Role != "editor" {
+		t.Errorf("unexpected members %+v", members)
+	}
+
+	// Viewers can only read
+	member := fmt.Sprintf("%s/members/%d", album, bob.ID)
+	app.do(http.MethodPatch, member, bob.Token, gin.H{"role": "owner"}, http.StatusForbidden)
+	app.do(http.MethodPatch, member, alice.Token, gin.H{"role": "boss"}, http.StatusBadRequest)
+	app.do(http.MethodPatch, fmt.Sprintf("%s/members/%d", album, carol.ID), alice.Token, gin.H{"role": "viewer"}, http.StatusNotFound)
+	app.do(http.MethodPatch, member, alice.Token, gin.H{"role": "viewer"}, http.StatusOK)
+	app.do(http.MethodPost, album+"/songs", bob.Token, gin.H{"youtube_url": "https://youtu.be/9bZkp7q19f0"}, http.StatusForbidden)
+
+	// Pending invitations can be revoked
+	invitation := decode[struct {
+		ID uint `json:"id"`
+	}](t, app.do(http.MethodPost, album+"/invitations", alice.Token, gin.H{"email": carol.Email, "role": "viewer"}, http.StatusCreated))
+	app.do(http.MethodDelete, fmt.Sprintf("%s/invitations/%d", album, invitation.ID), bob.Token, nil, http.StatusForbidden)
+	app.do(http.MethodDelete, fmt.Sprintf("%s/invitations/%d", album, invitation.ID), alice.Token, nil, http.StatusOK)
+	app.do(http.MethodPost, "/invitations/accept", carol.Token, gin.H{"token": app.mailer.token(t, carol.Email)}, http.StatusBadRequest)
+
+	// Members can leave, after which the album is hidden from them again
+	app.do(http.MethodDelete, fmt.Sprintf("%s/members/%d", album, alice.ID), bob.Token, nil, http.StatusForbidden)
+	app.do(http.MethodDelete, member, bob.Token, nil, http.StatusOK)
+	app.do(http.MethodGet, album, bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodDelete, member, alice.Token, nil, http.StatusNotFound)
+}
+
+func TestTags(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+
+	app.do(http.MethodPost, "/tags", alice.Token, gin.H{}, http.StatusBadRequest)
+	tag := decode[struct {
+		ID uint `json:"id"`
+	}](t, app.do(http.MethodPost, "/tags", alice.Token, gin.H{"name": "jazz"}, http.StatusCreated))
+	app.do(http.MethodPost, "/tags", alice.Token, gin.H{"name": "jazz"}, http.StatusConflict)
+
+	tags := decode[[]map[string]interface{}](t, app.do(http.MethodGet, "/tags", alice.Token, nil, http.StatusOK))
+	if len(tags) != 1 || tags[0]["name"] != "jazz" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	album := decode[albumResponse](t, app.do(http.MethodPost, "/albums", alice.Token, gin.H{"title": "Tagged", "tag_ids": []uint{tag.ID}}, http.StatusCreated))
+	if len(album.Tags) != 1 || album.Tags[0].Name != "jazz" {
+		t.Errorf("album tags %+v", album.Tags)
+	}
+}
+
+func TestSongs(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	public := app.createAlbum(alice, "Public", "public")
+	private := app.createAlbum(alice, "Private", "private")
+	songs := fmt.Sprintf("/albums/%d/songs", public)
+
+	app.do(http.MethodPost, songs, alice.Token, gin.H{}, http.StatusBadRequest)
+	app.do(http.MethodPost, songs, alice.Token, gin.H{"youtube_url": "https://vimeo.com/123"}, http.StatusBadRequest)
+
+	song := decode[map[string]interface{}](t, app.do(http.MethodPost, songs, alice.Token, gin.H{"youtube_url": "https://youtu.be/dQw4w9WgXcQ"}, http.StatusCreated))
+	if song["title"] != "Video dQw4w9WgXcQ" || song["view_count"] != 1000.0 || song["duration_seconds"] != 213.0 {
+		t.Errorf("song without YouTube metadata: %v", song)
+	}
+	named := decode[map[string]interface{}](t, app.do(http.MethodPost, songs, alice.Token,
+		gin.H{"youtube_url": "https://www.youtube.com/watch?v=9bZkp7q19f0", "title": "My title"}, http.StatusCreated))
+	if named["title"] != "My title" {
+		t.Errorf("title not kept: %v", named)
+	}
+
+	// Bob reads the public album but cannot change it, and cannot see the private one
+	list := decode[[]map[string]interface{}](t, app.do(http.MethodGet, songs, bob.Token, nil, http.StatusOK))
+	if len(list) != 2 {
+		t.Errorf("album has %d songs, want 2", len(list))
+	}
+	app.do(http.MethodPost, songs, bob.Token, gin.H{"youtube_url": "https://youtu.be/dQw4w9WgXcQ"}, http.StatusForbidden)
+	app.do(http.MethodGet, fmt.Sprintf("/albums/%d/songs", private), bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodPost, fmt.Sprintf("/albums/%d/songs", private), bob.Token, gin.H{"youtube_url": "https://youtu.be/dQw4w9WgXcQ"}, http.StatusNotFound)
+
+	songPath := fmt.Sprintf("%s/%v", songs, song["id"])
+	app.do(http.MethodDelete, songPath, bob.Token, nil, http.StatusForbidden)
+	app.do(http.MethodDelete, fmt.Sprintf("/albums/%d/songs/%v", private, song["id"]), alice.Token, nil, http.StatusNotFound)
+	app.do(http.MethodDelete, songPath, alice.Token, nil, http.StatusOK)
+	app.do(http.MethodDelete, songPath, alice.Token, nil, http.StatusNotFound)
+}
+
+func TestSongThumbnail(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	private := app.createAlbum(alice, "Album", "private")
+	songID := app.addSong(alice, private, "dQw4w9WgXcQ")
+
+	// The album page loads the album, then the thumbnails in <img> tags without credentials
+	album := decode[albumResponse](t, app.do(http.MethodGet, fmt.Sprintf("/albums/%d", private), alice.Token, nil, http.StatusOK))
+	if len(album.Songs) != 1 || !strings.HasPrefix(album.Songs[0].CachedThumbnailURL, fmt.Sprintf("/songs/%d/thumbnail?token=", songID)) {
+		t.Fatalf("no thumbnail URL in %+v", album.Songs)
+	}
+	path := album.Songs[0].CachedThumbnailURL
+
+	rec := app.do(http.MethodGet, path, "", nil, http.StatusOK)
+	etag := rec.Header().Get("ETag")
+	if rec.Header().Get("Content-Type") != "image/png" || etag == "" || rec.Header().Get("Cache-Control") != "private, max-age=86400" {
+		t.Errorf("unexpected thumbnail headers %v", rec.Header())
+	}
+
+	req := app.newRequest(http.MethodGet, path, "", nil)
+	req.Header.Set("If-None-Match", etag)
+	app.expect(req, http.StatusNotModified)
+
+	// The same URL is returned while it is valid, so browsers can cache the image
+	again := decode[albumResponse](t, app.do(http.MethodGet, fmt.Sprintf("/albums/%d", private), alice.Token, nil, http.StatusOK))
+	if again.Songs[0].CachedThumbnailURL != path {
+		t.Error("thumbnail URL changed")
+	}
+
+	// Thumbnails need a valid link for the song's album
+	thumbnail := fmt.Sprintf("/songs/%d/thumbnail", songID)
+	app.do(http.MethodGet, thumbnail, alice.Token, nil, http.StatusForbidden)
+	app.do(http.MethodGet, path+"x", "", nil, http.StatusForbidden)
+	app.do(http.MethodGet, thumbnail+"?token="+alice.Token, "", nil, http.StatusForbidden)
+
+	public := app.createAlbum(alice, "Public", "public")
+	app.addSong(alice, public, "dQw4w9WgXcQ")
+	shown := decode[albumResponse](t, app.do(http.MethodGet, fmt.Sprintf("/public/albums/%d", public), "", nil, http.StatusOK))
+	app.do(http.MethodGet, shown.Songs[0].CachedThumbnailURL, "", nil, http.StatusOK)
+	publicToken := strings.SplitN(shown.Songs[0].CachedThumbnailURL, "?", 2)[1]
+	app.do(http.MethodGet, thumbnail+"?"+publicToken, bob.Token, nil, http.StatusForbidden)
+	app.do(http.MethodGet, "/songs/9999/thumbnail?"+publicToken, "", nil, http.StatusNotFound)
+
+	expired, err := utils.SignClaims(jwt.MapClaims{"album_id": private, "aud": "song-thumbnail", "exp": time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.do(http.MethodGet, thumbnail+"?token="+expired, "", nil, http.StatusForbidden)
+}
+
+func TestEnrichAlbum(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+
+	// Albums can be enriched on creation, which never fails the creation
+	created := decode[albumResponse](t, app.do(http.MethodPost, "/albums", alice.Token,
+		gin.H{"title": "Blue Train", "artist": "John Coltrane", "enrich": true}, http.StatusCreated))
+	if created.MBID != fakeMBID || len(created.Tracks) != 2 {
+		t.Errorf("album not enriched on creation: %+v", created)
+	}
+	unknown := app.createAlbum(alice, "Unknown", "private")
+
+	enriched := decode[albumResponse](t, app.do(http.MethodPost, fmt.Sprintf("/albums/%d/enrich", unknown), alice.Token,
+		gin.H{"mbid": fakeMBID}, http.StatusOK))
+	if enriched.Label != "Blue Note" || len(enriched.Tracks) != 2 || enriched.Tracks[0].Title != "Blue Train" {
+		t.Errorf("unexpected enrichment %+v", enriched)
+	}
+
+	other := app.createAlbum(alice, "Not On MusicBrainz", "public")
+	app.do(http.MethodPost, fmt.Sprintf("/albums/%d/enrich", other), alice.Token, nil, http.StatusNotFound)
+	app.do(http.MethodPost, fmt.Sprintf("/albums/%d/enrich", other), bob.Token, nil, http.StatusForbidden)
+	app.do(http.MethodPost, fmt.Sprintf("/albums/%d/enrich", unknown), bob.Token, nil, http.StatusNotFound)
+}
+
+func TestAlbumCover(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	albumID := app.createAlbum(alice, "Covered", "public")
+	cover := fmt.Sprintf("/albums/%d/cover", albumID)
+
+	app.upload(http.MethodPost, cover, alice.Token, "image", "cover.txt", []byte("not an image"), http.StatusUnsupportedMediaType)
+	app.upload(http.MethodPost, cover, bob.Token, "image", "cover.png", testPNG(t, 800, 400), http.StatusForbidden)
+	app.do(http.MethodDelete, cover, alice.Token, nil, http.StatusNotFound)
+
+	album := decode[albumResponse](t, app.upload(http.MethodPost, cover, alice.Token, "image", "cover.png", testPNG(t, 800, 400), http.StatusOK))
+	for _, size := range []string{"original", "150", "300", "600"} {
+		if !strings.HasPrefix(album.CoverImages[size], "/media/covers/") {
+			t.Fatalf("missing %s cover image: %v", size, album.CoverImages)
+		}
+	}
+
+	rec := app.do(http.MethodGet, album.CoverImages["original"], "", nil, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "image/png" || rec.Body.Len() == 0 {
+		t.Errorf("unexpected original cover %v", rec.Header())
+	}
+	if rec := app.do(http.MethodGet, album.CoverImages["150"], "", nil, http.StatusOK); rec.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("unexpected thumbnail %v", rec.Header())
+	}
+	app.do(http.MethodGet, "/media/covers/unknown.png", "", nil, http.StatusNotFound)
+	app.do(http.MethodGet, "/media/private/file", "", nil, http.StatusNotFound)
+
+	app.do(http.MethodDelete, cover, bob.Token, nil, http.StatusForbidden)
+	app.do(http.MethodDelete, cover, alice.Token, nil, http.StatusOK)
+	app.do(http.MethodGet, album.CoverImages["original"], "", nil, http.StatusNotFound)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegisterVerifyAndLogin(t *testing.T) {
+	app := newTestApp(t)
+
+	user := app.register("bob")
+	app.do(http.MethodPost, "/register", "", gin.H{"email": user.Email, "password": testPassword}, http.StatusConflict)
+	app.do(http.MethodPost, "/register", "", gin.H{"email": "not-an-email", "password": testPassword}, http.StatusBadRequest)
+	app.do(http.MethodPost, "/register", "", gin.H{"email": "short@example.com", "password": "123"}, http.StatusBadRequest)
+
+	// The account cannot be used before the email address is verified
+	app.do(http.MethodPost, "/login", "", gin.H{"email": user.Email, "password": testPassword}, http.StatusForbidden)
+	app.do(http.MethodGet, "/verify-email", "", nil, http.StatusBadRequest)
+	app.do(http.MethodGet, "/verify-email?token=invalid", "", nil, http.StatusBadRequest)
+
+	first := app.mailer.token(t, user.Email)
+	app.do(http.MethodPost, "/verify-email/resend", "", gin.H{"email": user.Email}, http.StatusOK)
+	second := app.mailer.token(t, user.Email)
+	if first == second {
+		t.Fatal("resending the verification email reused the token")
+	}
+
+	app.do(http.MethodGet, "/verify-email?token="+url.QueryEscape(second), "", nil, http.StatusOK)
+	app.do(http.MethodGet, "/verify-email?token="+url.QueryEscape(second), "", nil, http.StatusBadRequest)
+
+	app.do(http.MethodPost, "/login", "", gin.H{"email": user.Email, "password": "wrong-password"}, http.StatusUnauthorized)
+	app.do(http.MethodPost, "/login", "", gin.H{"email": "nobody@example.com", "password": testPassword}, http.StatusUnauthorized)
+	token := app.login(user.Email, testPassword)
+
+	profile := decode[map[string]interface{}](t, app.do(http.MethodGet, "/profile", token, nil, http.StatusOK))
+	if profile["email"] != user.Email || profile["email_verified"] != true || profile["is_admin"] != false {
+		t.Errorf("unexpected profile %v", profile)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	app := newTestApp(t)
+
+	rec := app.do(http.MethodGet, "/.well-known/jwks.json", "", nil, http.StatusOK)
+	if _, ok := decode[map[string]interface{}](t, rec)["keys"]; !ok {
+		t.Errorf("JWKS without keys: %s", rec.Body.String())
+	}
+}
+
+func TestOIDCNotConfigured(t *testing.T) {
+	app := newTestApp(t)
+
+	app.do(http.MethodGet, "/auth/oidc/login", "", nil, http.StatusNotFound)
+	app.do(http.MethodGet, "/auth/oidc/callback?code=abc&state=def", "", nil, http.StatusNotFound)
+}
+
+// withState replaces the state parameter of a callback path
+func withState(callback, state string) string {
+	u, _ := url.Parse(callback)
+	query := u.Query()
+	query.Set("state", state)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// oidcUser is the response of a successful OIDC callback
+type oidcUser struct {
+	User struct {
+		ID            uint   `json:"id"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	} `json:"user"`
+	Token string `json:"token"`
+}
+
+func TestOIDCLogin(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newMockIssuer(t)
+	app.handler.OIDC = issuer.provider()
+	alice := mockIdentity{Subject: "alice-sub", Email: "alice@example.com", Name: "Alice", EmailVerified: true}
+
+	callback, cookie := app.oidcLogin(issuer, alice)
+	first := decode[oidcUser](t, app.oidcCallback(callback, cookie, http.StatusOK))
+	if first.User.Email != alice.Email || !first.User.EmailVerified {
+		t.Errorf("unexpected user %+v", first.User)
+	}
+	app.do(http.MethodGet, "/profile", first.Token, nil, http.StatusOK)
+
+	// Authorization codes are single use
+	app.oidcCallback(callback, cookie, http.StatusUnauthorized)
+
+	// The next login finds the linked account
+	callback, cookie = app.oidcLogin(issuer, alice)
+	if again := decode[oidcUser](t, app.oidcCallback(callback, cookie, http.StatusOK)); again.User.ID != first.User.ID {
+		t.Errorf("second login created user %d, want %d", again.User.ID, first.User.ID)
+	}
+
+	t.Run("state mismatch", func(t *testing.T) {
+		callback, cookie := app.oidcLogin(issuer, alice)
+		app.oidcCallback(withState(callback, "forged"), cookie, http.StatusBadRequest)
+		app.oidcCallback(callback, nil, http.StatusBadRequest)
+	})
+
+	t.Run("PKCE mismatch", func(t *testing.T) {
+		// The code of another login cannot be redeemed with this login's verifier
+		callback, cookie := app.oidcLogin(issuer, alice)
+		other, _ := app.oidcLogin(issuer, alice)
+		state, _ := url.Parse(callback)
+		app.oidcCallback(withState(other, state.Query().Get("state")), cookie, http.StatusUnauthorized)
+	})
+
+	t.Run("bad nonce", func(t *testing.T) {
+		callback, cookie := app.oidcLogin(issuer, alice)
+		issuer.mu.Lock()
+		issuer.nonce = "replayed"
+		issuer.mu.Unlock()
+		defer func() {
+			issuer.mu.Lock()
+			issuer.nonce = ""
+			issuer.mu.Unlock()
+		}()
+		app.oidcCallback(callback, cookie, http.StatusUnauthorized)
+	})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		callback, cookie := app.oidcLogin(issuer, alice)
+		issuer.mu.Lock()
+		issuer.kid = "rotated-key"
+		issuer.mu.Unlock()
+		defer func() {
+			issuer.mu.Lock()
+			issuer.kid = ""
+			issuer.mu.Unlock()
+		}()
+		app.oidcCallback(callback, cookie, http.StatusUnauthorized)
+	})
+}
+
+func TestOIDCLinksAccounts(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newMockIssuer(t)
+	app.handler.OIDC = issuer.provider()
+
+	// A verified local account is linked when the provider verified the address
+	bob := app.newUser("bob")
+	callback, cookie := app.oidcLogin(issuer, mockIdentity{Subject: "bob-sub", Email: bob.Email, EmailVerified: true})
+	if linked := decode[oidcUser](t, app.oidcCallback(callback, cookie, http.StatusOK)); linked.User.ID != bob.ID {
+		t.Errorf("identity linked to user %d, want %d", linked.User.ID, bob.ID)
+	}
+	callback, cookie = app.oidcLogin(issuer, mockIdentity{Subject: "bob-other", Email: bob.Email})
+	app.oidcCallback(callback, cookie, http.StatusConflict)
+
+	// Someone registered the victim's address before them: the password they
+	// chose stops working once the owner of the address signs in
+	squatted := app.register("victim")
+	callback, cookie = app.oidcLogin(issuer, mockIdentity{Subject: "victim-sub", Email: squatted.Email, EmailVerified: true})
+	victim := decode[oidcUser](t, app.oidcCallback(callback, cookie, http.StatusOK))
+	if victim.User.ID != squatted.ID || !victim.User.EmailVerified {
+		t.Errorf("unexpected user %+v", victim.User)
+	}
+	app.do(http.MethodPost, "/login", "", gin.H{"email": squatted.Email, "password": squatted.Password}, http.StatusUnauthorized)
+	app.do(http.MethodGet, "/profile", victim.Token, nil, http.StatusOK)
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApp(t)
+	user := app.newUser("carol")
+
+	// Unknown addresses get the same answer and no email
+	app.do(http.MethodPost, "/password/forgot", "", gin.H{"email": "nobody@example.com"}, http.StatusOK)
+	if len(app.mailer.sent) != 1 {
+		t.Fatalf("%d emails sent, want only the verification email", len(app.mailer.sent))
+	}
+
+	app.do(http.MethodPost, "/password/forgot", "", gin.H{"email": user.Email}, http.StatusOK)
+	token := app.mailer.token(t, user.Email)
+
+	app.do(http.MethodPost, "/password/reset", "", gin.H{"token": "invalid", "password": "new-password"}, http.StatusBadRequest)
+	app.do(http.MethodPost, "/password/reset", "", gin.H{"token": token, "password": "new-password"}, http.StatusOK)
+	app.do(http.MethodPost, "/password/reset", "", gin.H{"token": token, "password": "other-password"}, http.StatusBadRequest)
+
+	// Tokens issued with the old password are revoked
+	app.do(http.MethodGet, "/profile", user.Token, nil, http.StatusUnauthorized)
+	app.do(http.MethodPost, "/login", "", gin.H{"email": user.Email, "password": testPassword}, http.StatusUnauthorized)
+	app.login(user.Email, "new-password")
+}
+
+func TestUpdateProfile(t *testing.T) {
+	app := newTestApp(t)
+	user := app.newUser("dave")
+	other := app.newUser("erin")
+
+	profile := decode[map[string]interface{}](t, app.do(http.MethodPatch, "/profile", user.Token, gin.H{"name": "David"}, http.StatusOK))
+	if profile["name"] != "David" {
+		t.Errorf("name not updated: %v", profile)
+	}
+
+	// Changing the email address needs the password and a new verification
+	app.do(http.MethodPatch, "/profile", user.Token, gin.H{"email": "david@example.com"}, http.StatusUnauthorized)
+	app.do(http.MethodPatch, "/profile", user.Token, gin.H{"email": other.Email, "current_password": testPassword}, http.StatusConflict)
+	profile = decode[map[string]interface{}](t, app.do(http.MethodPatch, "/profile", user.Token,
+		gin.H{"email": "david@example.com", "current_password": testPassword}, http.StatusOK))
+	if profile["email"] != "david@example.com" || profile["email_verified"] != false {
+		t.Errorf("email not updated: %v", profile)
+	}
+	app.do(http.MethodGet, "/verify-email?token="+url.QueryEscape(app.mailer.token(t, "david@example.com")), "", nil, http.StatusOK)
+	app.login("david@example.com", testPassword)
+}
+
+func TestChangePassword(t *testing.T) {
+	app := newTestApp(t)
+	user := app.newUser("frank")
+
+	app.do(http.MethodPost, "/profile/password", user.Token, gin.H{"current_password": "wrong-password", "new_password": "new-password"}, http.StatusUnauthorized)
+	app.do(http.MethodPost, "/profile/password", user.Token, gin.H{"current_password": testPassword, "new_password": "123"}, http.StatusBadRequest)
+
+	rec := app.do(http.MethodPost, "/profile/password", user.Token, gin.H{"current_password": testPassword, "new_password": "new-password"}, http.StatusOK)
+	token := decode[struct {
+		Token string `json:"token"`
+	}](t, rec).Token
+
+	app.do(http.MethodGet, "/profile", user.Token, nil, http.StatusUnauthorized)
+	app.do(http.MethodGet, "/profile", token, nil, http.StatusOK)
+	app.login(user.Email, "new-password")
+}
+
+func TestDeleteProfile(t *testing.T) {
+	app := newTestApp(t)
+	user := app.newUser("gina")
+	heir := app.newUser("hank")
+	kept := app.createAlbum(user, "Kept", "private")
+	app.addSong(user, kept, "dQw4w9WgXcQ")
+
+	app.do(http.MethodDelete, "/profile", user.Token, gin.H{"password": "wrong-password"}, http.StatusUnauthorized)
+	app.do(http.MethodDelete, "/profile", user.Token, gin.H{"password": testPassword, "album_policy": "archive"}, http.StatusBadRequest)
+	app.do(http.MethodDelete, "/profile", user.Token, gin.H{"password": testPassword, "album_policy": "reassign", "reassign_to": user.Email}, http.StatusBadRequest)
+	app.do(http.MethodDelete, "/profile", user.Token, gin.H{"password": testPassword, "album_policy": "reassign", "reassign_to": heir.Email}, http.StatusOK)
+
+	app.do(http.MethodGet, "/profile", user.Token, nil, http.StatusUnauthorized)
+	app.do(http.MethodPost, "/login", "", gin.H{"email": user.Email, "password": testPassword}, http.StatusUnauthorized)
+
+	// The albums now belong to the other account, with their songs
+	songs := decode[[]map[string]interface{}](t, app.do(http.MethodGet, fmt.Sprintf("/albums/%d/songs", kept), heir.Token, nil, http.StatusOK))
+	if len(songs) != 1 {
+		t.Errorf("reassigned album has %d songs, want 1", len(songs))
+	}
+
+	// By default the albums are deleted with the account
+	leaver := app.newUser("ivan")
+	deleted := app.createAlbum(leaver, "Deleted", "public")
+	app.do(http.MethodDelete, "/profile", leaver.Token, gin.H{"password": testPassword}, http.StatusOK)
+	app.do(http.MethodGet, fmt.Sprintf("/public/albums/%d", deleted), "", nil, http.StatusNotFound)
+}
+
+func TestAPIKeys(t *testing.T) {
+	app := newTestApp(t)
+	user := app.newUser("judy")
+	other := app.newUser("kim")
+	albumID := app.createAlbum(user, "Keys", "private")
+
+	app.do(http.MethodPost, "/api-keys", user.Token, gin.H{"name": "empty", "scopes": []string{}}, http.StatusBadRequest)
+	app.do(http.MethodPost, "/api-keys", user.Token, gin.H{"name": "unknown", "scopes": []string{"albums:delete"}}, http.StatusBadRequest)
+	app.do(http.MethodPost, "/api-keys", user.Token, gin.H{"name": "expired", "scopes": []string{"albums:read"}, "expires_at": "2000-01-01T00:00:00Z"}, http.StatusBadRequest)
+
+	rec := app.do(http.MethodPost, "/api-keys", user.Token, gin.H{"name": "reader", "scopes": []string{"albums:read"}}, http.StatusCreated)
+	key := decode[struct {
+		ID  uint   `json:"id"`
+		Key string `json:"key"`
+	}](t, rec)
+
+	// The key grants its scopes only, and never the account routes
+	albums := decode[[]map[string]interface{}](t, app.do(http.MethodGet, "/albums", key.Key, nil, http.StatusOK))
+	if len(albums) != 1 {
+		t.Errorf("API key sees %d albums, want 1", len(albums))
+	}
+	app.do(http.MethodGet, fmt.Sprintf("/albums/%d", albumID), key.Key, nil, http.StatusOK)
+	app.do(http.MethodPost, "/albums", key.Key, gin.H{"title": "Denied"}, http.StatusForbidden)
+	app.do(http.MethodGet, "/playlists", key.Key, nil, http.StatusForbidden)
+	app.do(http.MethodGet, "/profile", key.Key, nil, http.StatusForbidden)
+	app.do(http.MethodGet, "/api-keys", key.Key, nil, http.StatusForbidden)
+
+	keys := decode[[]map[string]interface{}](t, app.do(http.MethodGet, "/api-keys", user.Token, nil, http.StatusOK))
+	if len(keys) != 1 || keys[0]["key"] != nil || keys[0]["last_used_at"] == nil {
+		t.Errorf("unexpected key list %v", keys)
+	}
+	if others := decode[[]map[string]interface{}](t, app.do(http.MethodGet, "/api-keys", other.Token, nil, http.StatusOK)); len(others) != 0 {
+		t.Errorf("another user sees %d keys", len(others))
+	}
+
+	path := fmt.Sprintf("/api-keys/%d", key.ID)
+	app.do(http.MethodDelete, path, other.Token, nil, http.StatusNotFound)
+	app.do(http.MethodDelete, path, user.Token, nil, http.StatusOK)
+	app.do(http.MethodGet, "/albums", key.Key, nil, http.StatusUnauthorized)
+}
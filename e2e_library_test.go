@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSVExportEscapesFormulas(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	formula := `=HYPERLINK("https://evil.example.com","click")`
+	app.createAlbum(alice, formula, "private")
+	app.createAlbum(alice, "-Minus", "private")
+
+	csv := app.do(http.MethodGet, "/export?format=csv", alice.Token, nil, http.StatusOK).Body.String()
+	if !strings.Contains(csv, `"'=HYPERLINK(""https://evil.example.com"",""click"")"`) || !strings.Contains(csv, "\n'-Minus,") {
+		t.Errorf("formulas not escaped in %q", csv)
+	}
+
+	// The escaping is undone on import
+	app.uploadForm(http.MethodPost, "/import?format=csv", bob.Token, "file", "library.csv", []byte(csv), nil, http.StatusOK)
+	albums := decode[[]albumResponse](t, app.do(http.MethodGet, "/albums", bob.Token, nil, http.StatusOK))
+	if !hasTitle(albums, formula) || !hasTitle(albums, "-Minus") {
+		t.Errorf("imported %v", albumTitles(albums))
+	}
+}
+
+func TestExportAndImportLibrary(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	albumID := app.createAlbum(alice, "Exported", "public")
+	app.addSong(alice, albumID, "dQw4w9WgXcQ")
+
+	export := app.do(http.MethodGet, "/export", alice.Token, nil, http.StatusOK)
+	library := decode[struct {
+		Version int `json:"version"`
+		Albums  []struct {
+			Title string `json:"title"`
+			Songs []struct {
+				YoutubeURL string `json:"youtube_url"`
+			} `json:"songs"`
+		} `json:"albums"`
+	}](t, export)
+	if library.Version != 1 || len(library.Albums) != 1 || len(library.Albums[0].Songs) != 1 {
+		t.Fatalf("unexpected export %s", export.Body.String())
+	}
+
+	csv := app.do(http.MethodGet, "/export?format=csv", alice.Token, nil, http.StatusOK).Body.String()
+	if !strings.HasPrefix(csv, "album_title,") || !strings.Contains(csv, "Exported,Artist") {
+		t.Errorf("unexpected CSV export %q", csv)
+	}
+	m3u := app.do(http.MethodGet, "/export?format=m3u", alice.Token, nil, http.StatusOK).Body.String()
+	if !strings.HasPrefix(m3u, "#EXTM3U") || !strings.Contains(m3u, "dQw4w9WgXcQ") {
+		t.Errorf("unexpected M3U export %q", m3u)
+	}
+	app.do(http.MethodGet, "/export?format=xml", alice.Token, nil, http.StatusBadRequest)
+
+	// Bob's export does not contain alice's albums
+	if body := app.do(http.MethodGet, "/export", bob.Token, nil, http.StatusOK).Body.String(); strings.Contains(body, "Exported") {
+		t.Errorf("bob exported alice's album: %s", body)
+	}
+
+	type report struct {
+		DryRun        bool `json:"dry_run"`
+		AlbumsCreated int  `json:"albums_created"`
+		SongsAdded    int  `json:"songs_added"`
+	}
+
+	// A dry run reports the changes without saving them
+	dryRun := decode[report](t, app.uploadForm(http.MethodPost, "/import?dry_run=true", bob.Token, "file", "library.json", export.Body.Bytes(), nil, http.StatusOK))
+	if !dryRun.DryRun || dryRun.AlbumsCreated != 1 || dryRun.SongsAdded != 1 {
+		t.Errorf("unexpected dry run %+v", dryRun)
+	}
+	if albums := decode[[]albumResponse](t, app.do(http.MethodGet, "/albums", bob.Token, nil, http.StatusOK)); len(albums) != 0 {
+		t.Fatalf("dry run created %v", albumTitles(albums))
+	}
+
+	imported := decode[report](t, app.uploadForm(http.MethodPost, "/import", bob.Token, "file", "library.json", export.Body.Bytes(), nil, http.StatusOK))
+	if imported.DryRun || imported.AlbumsCreated != 1 || imported.SongsAdded != 1 {
+		t.Errorf("unexpected import %+v", imported)
+	}
+	albums := decode[[]albumResponse](t, app.do(http.MethodGet, "/albums", bob.Token, nil, http.StatusOK))
+	if len(albums) != 1 || albums[0].Title != "Exported" {
+		t.Errorf("bob owns %v after the import", albumTitles(albums))
+	}
+
+	// Importing the same file again changes nothing
+	again := decode[report](t, app.uploadForm(http.MethodPost, "/import", bob.Token, "file", "library.json", export.Body.Bytes(), nil, http.StatusOK))
+	if again.AlbumsCreated != 0 || again.SongsAdded != 0 {
+		t.Errorf("second import %+v", again)
+	}
+
+	// Invalid albums reject the whole file
+	invalid, _ := json.Marshal(gin.H{"version": 1, "albums": []gin.H{{"title": "Valid", "artist": "A"}, {"title": "", "artist": "B"}}})
+	app.uploadForm(http.MethodPost, "/import", bob.Token, "file", "invalid.json", invalid, nil, http.StatusUnprocessableEntity)
+	app.uploadForm(http.MethodPost, "/import?format=yaml", bob.Token, "file", "library.yaml", invalid, nil, http.StatusBadRequest)
+	if albums := decode[[]albumResponse](t, app.do(http.MethodGet, "/albums", bob.Token, nil, http.StatusOK)); len(albums) != 1 {
+		t.Errorf("rejected import created albums: %v", albumTitles(albums))
+	}
+
+	// CSV files can use their own columns
+	custom := "Name,Band,Video\nCustom,Someone,https://youtu.be/9bZkp7q19f0\n"
+	mapping := `{"title":"Name","artist":"Band","youtube_url":"Video"}`
+	fromCSV := decode[report](t, app.uploadForm(http.MethodPost, "/import?format=csv", bob.Token, "file", "library.csv", []byte(custom), map[string]string{"mapping": mapping}, http.StatusOK))
+	if fromCSV.AlbumsCreated != 1 || fromCSV.SongsAdded != 1 {
+		t.Errorf("unexpected CSV import %+v", fromCSV)
+	}
+}
+
+func TestPlaylists(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	public := app.createAlbum(alice, "Public", "public")
+	private := app.createAlbum(alice, "Private", "private")
+	songs := []uint{
+		app.addSong(alice, public, "dQw4w9WgXcQ"),
+		app.addSong(alice, public, "9bZkp7q19f0"),
+		app.addSong(alice, public, "kJQP7kiw5Fk"),
+	}
+	privateSong := app.addSong(alice, private, "JGwWNGJdvx8")
+
+	app.do(http.MethodPost, "/playlists", bob.Token, gin.H{}, http.StatusBadRequest)
+	playlist := decode[struct {
+		ID uint `json:"ID"`
+	}](t, app.do(http.MethodPost, "/playlists", bob.Token, gin.H{"name": "Mix"}, http.StatusCreated))
+	path := fmt.Sprintf("/playlists/%d", playlist.ID)
+
+	// Playlists are private to their owner
+	app.do(http.MethodGet, path, alice.Token, nil, http.StatusNotFound)
+	app.do(http.MethodPatch, path, alice.Token, gin.H{"name": "Stolen"}, http.StatusNotFound)
+	app.do(http.MethodPost, path+"/songs", alice.Token, gin.H{"song_id": songs[0]}, http.StatusNotFound)
+	if others := decode[[]map[string]interface{}](t, app.do(http.MethodGet, "/playlists", alice.Token, nil, http.StatusOK)); len(others) != 0 {
+		t.Errorf("alice sees %d playlists", len(others))
+	}
+
+	// Songs of albums bob cannot read cannot be added
+	app.do(http.MethodPost, path+"/songs", bob.Token, gin.H{"song_id": privateSong}, http.StatusNotFound)
+
+	type entry struct {
+		ID       uint `json:"id"`
+		Position int  `json:"position"`
+		SongID   uint `json:"song_id"`
+	}
+	var entries []entry
+	for _, songID := range songs {
+		entries = append(entries, decode[entry](t, app.do(http.MethodPost, path+"/songs", bob.Token, gin.H{"song_id": songID}, http.StatusCreated)))
+	}
+
+	app.do(http.MethodPatch, path, bob.Token, gin.H{"description": "Favourites"}, http.StatusOK)
+	app.do(http.MethodPost, fmt.Sprintf("%s/songs/%d/move", path, entries[2].ID), bob.Token, gin.H{"position": 0}, http.StatusOK)
+
+	order := func() []uint {
+		t.Helper()
+		detail := decode[struct {
+			Name        string  `json:"name"`
+			Description string  `json:"description"`
+			Entries     []entry `json:"entries"`
+		}](t, app.do(http.MethodGet, path, bob.Token, nil, http.StatusOK))
+		ids := make([]uint, len(detail.Entries))
+		for i, e := range detail.Entries {
+			ids[i] = e.SongID
+		}
+		return ids
+	}
+	if got := order(); fmt.Sprint(got) != fmt.Sprint([]uint{songs[2], songs[0], songs[1]}) {
+		t.Errorf("order after move %v", got)
+	}
+
+	app.do(http.MethodPut, path+"/order", bob.Token, gin.H{"entry_ids": []uint{entries[0].ID}}, http.StatusBadRequest)
+	app.do(http.MethodPut, path+"/order", bob.Token, gin.H{"entry_ids": []uint{entries[1].ID, entries[0].ID, entries[2].ID}}, http.StatusOK)
+	if got := order(); fmt.Sprint(got) != fmt.Sprint([]uint{songs[1], songs[0], songs[2]}) {
+		t.Errorf("order after reorder %v", got)
+	}
+
+	export := decode[struct {
+		URL   string `json:"url"`
+		Count int    `json:"count"`
+	}](t, app.do(http.MethodGet, path+"/export", bob.Token, nil, http.StatusOK))
+	if export.Count != 3 || !strings.HasSuffix(export.URL, "video_ids=9bZkp7q19f0,dQw4w9WgXcQ,kJQP7kiw5Fk") {
+		t.Errorf("unexpected export %+v", export)
+	}
+	if m3u := app.do(http.MethodGet, path+"/export?format=m3u", bob.Token, nil, http.StatusOK).Body.String(); !strings.HasPrefix(m3u, "#EXTM3U\n#PLAYLIST:Mix") {
+		t.Errorf("unexpected M3U export %q", m3u)
+	}
+
+	// Songs disappear from the playlist when alice hides their album
+	app.do(http.MethodPatch, fmt.Sprintf("/albums/%d", public), alice.Token, gin.H{"visibility": "private"}, http.StatusOK)
+	if got := order(); len(got) != 0 {
+		t.Errorf("playlist shows hidden songs %v", got)
+	}
+	app.do(http.MethodPatch, fmt.Sprintf("/albums/%d", public), alice.Token, gin.H{"visibility": "public"}, http.StatusOK)
+
+	app.do(http.MethodDelete, fmt.Sprintf("%s/songs/%d", path, entries[0].ID), alice.Token, nil, http.StatusNotFound)
+	app.do(http.MethodDelete, fmt.Sprintf("%s/songs/%d", path, entries[0].ID), bob.Token, nil, http.StatusOK)
+	if got := order(); fmt.Sprint(got) != fmt.Sprint([]uint{songs[1], songs[2]}) {
+		t.Errorf("order after removal %v", got)
+	}
+
+	if list := decode[[]map[string]interface{}](t, app.do(http.MethodGet, "/playlists", bob.Token, nil, http.StatusOK)); len(list) != 1 {
+		t.Errorf("bob has %d playlists", len(list))
+	}
+	app.do(http.MethodDelete, path, alice.Token, nil, http.StatusNotFound)
+	app.do(http.MethodDelete, path, bob.Token, nil, http.StatusOK)
+	app.do(http.MethodGet, path, bob.Token, nil, http.StatusNotFound)
+}
+
+func TestMetrics(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	admin := app.admin()
+	albumID := app.createAlbum(alice, "Album", "private")
+	app.addSong(alice, albumID, "dQw4w9WgXcQ")
+	app.addSong(alice, albumID, "dQw4w9WgXcQ")
+
+	app.do(http.MethodGet, "/admin/metrics", alice.Token, nil, http.StatusForbidden)
+
+	metrics := decode[struct {
+		YoutubeCache struct {
+			Hits   int64 `json:"hits"`
+			Misses int64 `json:"misses"`
+		} `json:"youtube_cache"`
+	}](t, app.do(http.MethodGet, "/admin/metrics", admin.Token, nil, http.StatusOK))
+	if metrics.YoutubeCache.Hits != 1 || metrics.YoutubeCache.Misses != 1 {
+		t.Errorf("unexpected cache metrics %+v", metrics.YoutubeCache)
+	}
+}
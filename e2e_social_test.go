@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"example/web-service-gin/controllers"
+	"example/web-service-gin/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFavouritesLikesAndRatings(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	public := app.createAlbum(alice, "Public", "public")
+	private := app.createAlbum(alice, "Private", "private")
+	songID := app.addSong(alice, public, "dQw4w9WgXcQ")
+	privateSong := app.addSong(alice, private, "9bZkp7q19f0")
+
+	// Bob can only interact with albums he can read
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/favourite", private), bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/songs/%d/like", private, privateSong), bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/rating", private), bob.Token, gin.H{"score": 4}, http.StatusNotFound)
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/songs/%d/like", public, privateSong), bob.Token, nil, http.StatusNotFound)
+
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/favourite", public), bob.Token, nil, http.StatusOK)
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/favourite", public), bob.Token, nil, http.StatusOK)
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/songs/%d/like", public, songID), bob.Token, nil, http.StatusOK)
+
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/rating", public), bob.Token, gin.H{"score": 6}, http.StatusBadRequest)
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/rating", public), alice.Token, gin.H{"score": 5}, http.StatusOK)
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/rating", public), bob.Token, gin.H{"score": 2}, http.StatusOK)
+	rating := decode[struct {
+		Score         int     `json:"score"`
+		AverageRating float64 `json:"average_rating"`
+		RatingCount   int64   `json:"rating_count"`
+	}](t, app.do(http.MethodPut, fmt.Sprintf("/albums/%d/rating", public), bob.Token, gin.H{"score": 3}, http.StatusOK))
+	if rating.Score != 3 || rating.AverageRating != 4 || rating.RatingCount != 2 {
+		t.Errorf("unexpected rating %+v", rating)
+	}
+
+	favourites := decode[[]albumResponse](t, app.do(http.MethodGet, "/favourites/albums", bob.Token, nil, http.StatusOK))
+	if len(favourites) != 1 || favourites[0].ID != public {
+		t.Errorf("bob's favourites %v", albumTitles(favourites))
+	}
+	liked := decode[[]map[string]interface{}](t, app.do(http.MethodGet, "/favourites/songs", bob.Token, nil, http.StatusOK))
+	if len(liked) != 1 || liked[0]["like_count"] != 1.0 {
+		t.Errorf("bob's liked songs %v", liked)
+	}
+
+	// Favourites of albums that became private disappear
+	app.do(http.MethodPatch, fmt.Sprintf("/albums/%d", public), alice.Token, gin.H{"visibility": "private"}, http.StatusOK)
+	if favourites := decode[[]albumResponse](t, app.do(http.MethodGet, "/favourites/albums", bob.Token, nil, http.StatusOK)); len(favourites) != 0 {
+		t.Errorf("bob still sees %v", albumTitles(favourites))
+	}
+	if liked := decode[[]map[string]interface{}](t, app.do(http.MethodGet, "/favourites/songs", bob.Token, nil, http.StatusOK)); len(liked) != 0 {
+		t.Errorf("bob still sees %d liked songs", len(liked))
+	}
+	app.do(http.MethodPatch, fmt.Sprintf("/albums/%d", public), alice.Token, gin.H{"visibility": "public"}, http.StatusOK)
+
+	app.do(http.MethodDelete, fmt.Sprintf("/albums/%d/favourite", public), bob.Token, nil, http.StatusOK)
+	app.do(http.MethodDelete, fmt.Sprintf("/albums/%d/songs/%d/like", public, songID), bob.Token, nil, http.StatusOK)
+	app.do(http.MethodDelete, fmt.Sprintf("/albums/%d/rating", public), bob.Token, nil, http.StatusOK)
+
+	album := decode[map[string]interface{}](t, app.do(http.MethodGet, fmt.Sprintf("/albums/%d", public), bob.Token, nil, http.StatusOK))
+	if album["favourite_count"] != 0.0 || album["rating_count"] != 1.0 || album["average_rating"] != 5.0 {
+		t.Errorf("unexpected album statistics %v", album)
+	}
+}
+
+func TestComments(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+	carol := app.newUser("carol")
+	admin := app.admin()
+	public := app.createAlbum(alice, "Public", "public")
+	private := app.createAlbum(alice, "Private", "private")
+	comments := fmt.Sprintf("/albums/%d/comments", public)
+
+	app.do(http.MethodPost, fmt.Sprintf("/albums/%d/comments", private), bob.Token, gin.H{"body": "Hi"}, http.StatusNotFound)
+	app.do(http.MethodGet, fmt.Sprintf("/albums/%d/comments", private), bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodPost, comments, bob.Token, gin.H{"body": "   "}, http.StatusBadRequest)
+
+	// Moderation hooks reject comments before they are saved
+	app.handler.CommentHooks = []controllers.CommentModerationHook{func(comment *models.Comment) error {
+		if strings.Contains(comment.Body, "spam") {
+			return errors.New("comment rejected as spam")
+		}
+		return nil
+	}}
+	app.do(http.MethodPost, comments, bob.Token, gin.H{"body": "Buy spam"}, http.StatusUnprocessableEntity)
+
+	type comment struct {
+		ID      uint   `json:"id"`
+		Body    string `json:"body"`
+		Replies []struct {
+			ID   uint   `json:"id"`
+			Body string `json:"body"`
+		} `json:"replies"`
+	}
+	first := decode[comment](t, app.do(http.MethodPost, comments, bob.Token, gin.H{"body": "Great album"}, http.StatusCreated))
+	reply := decode[comment](t, app.do(http.MethodPost, comments, carol.Token, gin.H{"body": "Agreed", "parent_id": first.ID}, http.StatusCreated))
+	app.do(http.MethodPost, comments, carol.Token, gin.H{"body": "Orphan", "parent_id": 9999}, http.StatusBadRequest)
+
+	threads := decode[[]comment](t, app.do(http.MethodGet, comments, alice.Token, nil, http.StatusOK))
+	if len(threads) != 1 || len(threads[0].Replies) != 1 || threads[0].Replies[0].ID != reply.ID {
+		t.Fatalf("unexpected threads %+v", threads)
+	}
+
+	// Only the author edits a comment, and the previous versions are kept
+	path := fmt.Sprintf("%s/%d", comments, first.ID)
+	app.do(http.MethodPatch, path, carol.Token, gin.H{"body": "Hijacked"}, http.StatusForbidden)
+	app.do(http.MethodPatch, path, bob.Token, gin.H{"body": "Great spam"}, http.StatusUnprocessableEntity)
+	app.do(http.MethodPatch, path, bob.Token, gin.H{"body": "Great album!"}, http.StatusOK)
+	history := decode[[]map[string]interface{}](t, app.do(http.MethodGet, path+"/history", carol.Token, nil, http.StatusOK))
+	if len(history) != 1 || history[0]["body"] != "Great album" {
+		t.Errorf("unexpected history %v", history)
+	}
+
+	// Authors, the album owner and admins can delete comments, nobody else
+	app.do(http.MethodDelete, path, carol.Token, nil, http.StatusForbidden)
+	app.do(http.MethodDelete, fmt.Sprintf("%s/%d", comments, reply.ID), alice.Token, gin.H{"reason": "off topic"}, http.StatusOK)
+	app.do(http.MethodDelete, path, admin.Token, nil, http.StatusOK)
+	app.do(http.MethodDelete, path, bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodPatch, path, bob.Token, gin.H{"body": "Back"}, http.StatusConflict)
+	app.do(http.MethodGet, path+"/history", bob.Token, nil, http.StatusNotFound)
+
+	own := decode[comment](t, app.do(http.MethodPost, comments, carol.Token, gin.H{"body": "Mine"}, http.StatusCreated))
+	app.do(http.MethodDelete, fmt.Sprintf("%s/%d", comments, own.ID), carol.Token, nil, http.StatusOK)
+
+	// Deleted comments stay in the thread without their body
+	threads = decode[[]comment](t, app.do(http.MethodGet, comments, alice.Token, nil, http.StatusOK))
+	if len(threads) != 2 || threads[0].Body != "" || threads[0].Replies[0].Body != "" {
+		t.Errorf("unexpected threads after deletion %+v", threads)
+	}
+}
+
+func TestFollowsAndFeed(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.newUser("alice")
+	bob := app.newUser("bob")
+
+	app.do(http.MethodPut, fmt.Sprintf("/users/%d/follow", bob.ID), bob.Token, nil, http.StatusBadRequest)
+	app.do(http.MethodPut, "/users/9999/follow", bob.Token, nil, http.StatusNotFound)
+	app.do(http.MethodPut, fmt.Sprintf("/users/%d/follow", alice.ID), bob.Token, nil, http.StatusOK)
+	app.do(http.MethodPut, fmt.Sprintf("/users/%d/follow", alice.ID), bob.Token, nil, http.StatusOK)
+
+	type user struct {
+		ID uint `json:"ID"`
+	}
+	following := decode[[]user](t, app.do(http.MethodGet, "/following", bob.Token, nil, http.StatusOK))
+	if len(following) != 1 || following[0].ID != alice.ID {
+		t.Errorf("bob follows %+v", following)
+	}
+	followers := decode[[]user](t, app.do(http.MethodGet, "/followers", alice.Token, nil, http.StatusOK))
+	if len(followers) != 1 || followers[0].ID != bob.ID {
+		t.Errorf("alice is followed by %+v", followers)
+	}
+
+	// Activity on private albums stays out of the feed
+	public := app.createAlbum(alice, "Public", "public")
+	private := app.createAlbum(alice, "Private", "private")
+	app.addSong(alice, public, "dQw4w9WgXcQ")
+	app.addSong(alice, private, "9bZkp7q19f0")
+	app.do(http.MethodPut, fmt.Sprintf("/albums/%d/rating", public), alice.Token, gin.H{"score": 4}, http.StatusOK)
+	app.do(http.MethodPost, "/tags", alice.Token, gin.H{"name": "jazz"}, http.StatusCreated)
+
+	type feed struct {
+		Activities []struct {
+			Type    string `json:"type"`
+			AlbumID *uint  `json:"album_id"`
+		} `json:"activities"`
+		NextCursor *string `json:"next_cursor"`
+	}
+	page := decode[feed](t, app.do(http.MethodGet, "/feed?limit=3", bob.Token, nil, http.StatusOK))
+	if len(page.Activities) != 3 || page.NextCursor == nil || page.Activities[0].Type != "tag_created" || page.Activities[1].Type != "album_rated" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	rest := decode[feed](t, app.do(http.MethodGet, "/feed?limit=3&cursor="+*page.NextCursor, bob.Token, nil, http.StatusOK))
+	if len(rest.Activities) != 1 || rest.NextCursor != nil || rest.Activities[0].Type != "album_created" {
+		t.Errorf("unexpected last page %+v", rest)
+	}
+	for _, activity := range append(page.Activities, rest.Activities...) {
+		if activity.AlbumID != nil && *activity.AlbumID == private {
+			t.Errorf("feed shows the private album: %+v", activity)
+		}
+	}
+	app.do(http.MethodGet, "/feed?limit=500", bob.Token, nil, http.StatusBadRequest)
+	app.do(http.MethodGet, "/feed?cursor=abc", bob.Token, nil, http.StatusBadRequest)
+
+	if own := decode[feed](t, app.do(http.MethodGet, "/feed", alice.Token, nil, http.StatusOK)); len(own.Activities) != 0 {
+		t.Errorf("alice sees %d activities without following anyone", len(own.Activities))
+	}
+
+	app.do(http.MethodDelete, fmt.Sprintf("/users/%d/follow", alice.ID), bob.Token, nil, http.StatusOK)
+	if page := decode[feed](t, app.do(http.MethodGet, "/feed", bob.Token, nil, http.StatusOK)); len(page.Activities) != 0 {
+		t.Errorf("feed still shows %d activities after unfollowing", len(page.Activities))
+	}
+}
@@ -0,0 +1,678 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example/web-service-gin/controllers"
+	"example/web-service-gin/initializers"
+	"example/web-service-gin/repository"
+	"example/web-service-gin/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// The end-to-end tests drive the router built by setupRouter against a fresh
+// in-memory SQLite database per test. External services are replaced by fakes:
+// emails are recorded, YouTube and MusicBrainz answer from memory and uploads
+// go to a temporary directory.
+
+// untestedRoutes cannot succeed in the harness and are only checked for their error responses
+var untestedRoutes = map[string]string{}
+
+// exercisedRoutes records the routes that answered a request successfully
+var exercisedRoutes sync.Map
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	log.SetOutput(io.Discard)
+
+	if err := utils.SetJWTKeys(utils.NewHMACKey("test", []byte(strings.Repeat("s", utils.MinJWTSecretLength)))); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	// Partial runs cannot cover every route
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" && flag.Lookup("test.skip").Value.String() == "" {
+		code = checkRouteCoverage()
+	}
+	os.Exit(code)
+}
+
+// checkRouteCoverage fails the run when a route was never called successfully
+func checkRouteCoverage() int {
+	var missing []string
+	for _, route := range setupRouter(&controllers.Handler{}).Routes() {
+		name := route.Method + " " + route.Path
+		if _, ok := exercisedRoutes.Load(name); !ok && untestedRoutes[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return 0
+	}
+	sort.Strings(missing)
+	fmt.Fprintf(os.Stderr, "routes without a successful end-to-end test:\n  %s\n", strings.Join(missing, "\n  "))
+	return 1
+}
+
+// testMail is an email recorded by testMailer
+type testMail struct {
+	To, Subject, Body string
+}
+
+// testMailer records the emails sent by the application
+type testMailer struct {
+	mu   sync.Mutex
+	sent []testMail
+}
+
+func (m *testMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, testMail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+var (
+	mailLinkToken = regexp.MustCompile(`[?&]token=(\S+)`)
+	mailLineToken = regexp.MustCompile(`\n\n([A-Za-z0-9_.\-]{20,})\n\n`)
+)
+
+// token returns the token of the last email sent to an address, from a link or on its own line
+func (m *testMailer) token(t *testing.T, to string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != to {
+			continue
+		}
+		if match := mailLinkToken.FindStringSubmatch(m.sent[i].Body); match != nil {
+			token, err := url.QueryUnescape(match[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}
+		if match := mailLineToken.FindStringSubmatch(m.sent[i].Body); match != nil {
+			return match[1]
+		}
+		t.Fatalf("no token in the email %q sent to %s", m.sent[i].Subject, to)
+	}
+	t.Fatalf("no email sent to %s", to)
+	return ""
+}
+
+// fakeVideoInfo describes every video without contacting YouTube
+func fakeVideoInfo(ctx context.Context, videoID string) (*utils.VideoInfo, error) {
+	return &utils.VideoInfo{
+		Title:        "Video " + videoID,
+		ThumbnailURL: "https://i.ytimg.com/vi/" + videoID + "/hqdefault.jpg",
+		ViewCount:    1000,
+		Duration:     3*time.Minute + 33*time.Second,
+	}, nil
+}
+
+// fakeMetadata knows a single MusicBrainz release
+type fakeMetadata struct{}
+
+const fakeMBID = "b1a9c0e9-d987-4042-ae91-78d6a3267d69"
+
+func (fakeMetadata) SearchRelease(ctx context.Context, artist, title string) (string, error) {
+	if title != "Blue Train" {
+		return "", utils.ErrReleaseNotFound
+	}
+	return fakeMBID, nil
+}
+
+func (fakeMetadata) LookupRelease(ctx context.Context, mbid string) (*utils.ReleaseMetadata, error) {
+	if mbid != fakeMBID {
+		return nil, utils.ErrReleaseNotFound
+	}
+	return &utils.ReleaseMetadata{
+		MBID:        fakeMBID,
+		Title:       "Blue Train",
+		Artist:      "John Coltrane",
+		ReleaseYear: 1957,
+		Label:       "Blue Note",
+		Tracks: []utils.ReleaseTrack{
+			{Position: 1, Title: "Blue Train", LengthMs: 643000},
+			{Position: 2, Title: "Moment's Notice", LengthMs: 550000},
+		},
+	}, nil
+}
+
+// mockIssuer is a local OpenID Connect provider serving discovery, JWKS and a token
+// endpoint. Its ID tokens are signed with a test RSA key.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+	// kid and nonce replace the key ID and nonce of the ID tokens when set
+	kid   string
+	nonce string
+}
+
+// mockIdentity is an account at the mock issuer
+type mockIdentity struct {
+	Subject       string
+	Email         string
+	Name          string
+	EmailVerified bool
+}
+
+// mockAuthorization is an authorization code waiting to be exchanged
+type mockAuthorization struct {
+	identity  mockIdentity
+	challenge string
+	nonce     string
+}
+
+const (
+	mockClientID = "test-client"
+	mockKeyID    = "issuer-key"
+)
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key, codes: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": mockKeyID,
+			"kty": "RSA",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", issuer.token)
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// provider returns the client configuration of the application at the issuer
+func (i *mockIssuer) provider() *utils.OIDCProvider {
+	return &utils.OIDCProvider{
+		IssuerURL:    i.server.URL,
+		ClientID:     mockClientID,
+		ClientSecret: "test-secret",
+		RedirectURL:  "http://localhost:8082/auth/oidc/callback",
+		HTTPClient:   i.server.Client(),
+	}
+}
+
+// authorize signs the identity in at the authorization URL the application redirected
+// to, and returns the callback path the issuer redirects the browser back to
+func (i *mockIssuer) authorize(t *testing.T, location string, identity mockIdentity) string {
+	t.Helper()
+	authURL, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, i.server.URL+"/authorize?") {
+		t.Fatalf("redirected to %q", location)
+	}
+	query := authURL.Query()
+	if query.Get("client_id") != mockClientID || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("invalid authorization request %q", location)
+	}
+
+	code, err := utils.GenerateRandomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.mu.Lock()
+	i.codes[code] = mockAuthorization{identity: identity, challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	i.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redirect.Path + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+}
+
+// token exchanges an authorization code, once, for an ID token
+func (i *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, _, ok := r.BasicAuth()
+	if !ok || clientID != mockClientID {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	i.mu.Lock()
+	auth, found := i.codes[r.PostFormValue("code")]
+	delete(i.codes, r.PostFormValue("code"))
+	kid, nonce := i.kid, i.nonce
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !found || r.PostFormValue("grant_type") != "authorization_code" || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	if kid == "" {
+		kid = mockKeyID
+	}
+	if nonce == "" {
+		nonce = auth.nonce
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            i.server.URL,
+		"aud":            mockClientID,
+		"sub":            auth.identity.Subject,
+		"email":          auth.identity.Email,
+		"email_verified": auth.identity.EmailVerified,
+		"name":           auth.identity.Name,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = kid
+	signed, err := idToken.SignedString(i.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": signed})
+}
+
+// roundTripFunc serves HTTP requests from a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// testPNG encodes a blank image of the given size
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var databaseCount atomic.Int64
+
+// testApp is the API running against its own database
+type testApp struct {
+	t       *testing.T
+	router  *gin.Engine
+	handler *controllers.Handler
+	mailer  *testMailer
+}
+
+// newTestApp builds the router on a handler with an empty in-memory database and
+// fake external services. Apps share no state, so their tests run in parallel.
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	t.Parallel()
+
+	// Every connection of the pool shares the named in-memory database, which
+	// disappears when the last one is closed
+	dsn := fmt.Sprintf("file:e2e%d?mode=memory&cache=shared&_busy_timeout=5000", databaseCount.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	initializers.SyncDatabase(db)
+
+	mailer := &testMailer{}
+	thumbnail := testPNG(t, 4, 3)
+	handler := &controllers.Handler{
+		DB:           db,
+		Repositories: repository.NewGormRepositories(db),
+		Mailer:       mailer,
+		Metadata:     fakeMetadata{},
+		Storage:      &utils.LocalStorage{Root: t.TempDir()},
+		VideoInfo:    &utils.VideoInfoCache{Cache: utils.NewLRUCache(100), TTL: time.Hour, Fetch: fakeVideoInfo},
+	}
+	handler.Thumbnails = &utils.ThumbnailCache{
+		Dir:      t.TempDir(),
+		MaxBytes: 1 << 20,
+		TTL:      time.Hour,
+		MaxImage: 1 << 20,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"image/png"}, "Etag": {`"thumb"`}},
+				Body:       io.NopCloser(bytes.NewReader(thumbnail)),
+				Request:    req,
+			}, nil
+		})},
+	}
+
+	return &testApp{t: t, router: setupRouter(handler), handler: handler, mailer: mailer}
+}
+
+// serve sends a request to the router and records the route when it succeeds
+func (a *testApp) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	if rec.Code < 400 {
+		if route := a.route(req.Method, req.URL.Path); route != "" {
+			exercisedRoutes.Store(route, true)
+		}
+	}
+	return rec
+}
+
+// route returns the registered route matching a request, as "METHOD /path/:param"
+func (a *testApp) route(method, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, route := range a.router.Routes() {
+		if route.Method != method {
+			continue
+		}
+		pattern := strings.Split(strings.Trim(route.Path, "/"), "/")
+		if matchRoute(pattern, segments) {
+			return route.Method + " " + route.Path
+		}
+	}
+	return ""
+}
+
+func matchRoute(pattern, segments []string) bool {
+	for i, part := range pattern {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(segments) || (!strings.HasPrefix(part, ":") && part != segments[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+// newRequest builds a request authenticated with a JWT, an API key (wsg_ prefix) or nothing.
+// A non-nil body is sent as JSON.
+func (a *testApp) newRequest(method, path, credential string, body interface{}) *http.Request {
+	a.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	authenticate(req, credential)
+	return req
+}
+
+func authenticate(req *http.Request, credential string) {
+	switch {
+	case credential == "":
+	case strings.HasPrefix(credential, "wsg_"):
+		req.Header.Set("X-API-Key", credential)
+	default:
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+}
+
+// do sends a request and fails the test when the response status is not the expected one
+func (a *testApp) do(method, path, credential string, body interface{}, status int) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.expect(a.newRequest(method, path, credential, body), status)
+}
+
+// expect sends a prepared request and checks the response status
+func (a *testApp) expect(req *http.Request, status int) *httptest.ResponseRecorder {
+	a.t.Helper()
+	rec := a.serve(req)
+	if rec.Code != status {
+		a.t.Fatalf("%s %s: got status %d, want %d: %s", req.Method, req.URL, rec.Code, status, rec.Body.String())
+	}
+	return rec
+}
+
+// upload sends a file as multipart form data
+func (a *testApp) upload(method, path, credential, field, filename string, data []byte, status int) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.uploadForm(method, path, credential, field, filename, data, nil, status)
+}
+
+// uploadForm sends a file and extra form fields as multipart form data
+func (a *testApp) uploadForm(method, path, credential, field, filename string, data []byte, fields map[string]string, status int) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile(field, filename)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	authenticate(req, credential)
+	return a.expect(req, status)
+}
+
+// decode unmarshals a JSON response
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+// testUser is a verified account logged in through the API
+type testUser struct {
+	ID       uint
+	Email    string
+	Password string
+	Token    string
+}
+
+const testPassword = "password123"
+
+// register creates an account without verifying it
+func (a *testApp) register(name string) testUser {
+	a.t.Helper()
+	email := name + "@example.com"
+	rec := a.do(http.MethodPost, "/register", "", gin.H{"email": email, "password": testPassword, "name": name}, http.StatusCreated)
+	response := decode[struct {
+		User struct {
+			ID uint `json:"id"`
+		} `json:"user"`
+	}](a.t, rec)
+	return testUser{ID: response.User.ID, Email: email, Password: testPassword}
+}
+
+// newUser registers an account, verifies it from the email it received and logs in
+func (a *testApp) newUser(name string) testUser {
+	a.t.Helper()
+	user := a.register(name)
+	a.do(http.MethodGet, "/verify-email?token="+url.QueryEscape(a.mailer.token(a.t, user.Email)), "", nil, http.StatusOK)
+	user.Token = a.login(user.Email, user.Password)
+	return user
+}
+
+// login returns a JWT for the account
+func (a *testApp) login(email, password string) string {
+	a.t.Helper()
+	rec := a.do(http.MethodPost, "/login", "", gin.H{"email": email, "password": password}, http.StatusOK)
+	return decode[struct {
+		Token string `json:"token"`
+	}](a.t, rec).Token
+}
+
+// oidcLogin starts a login with the mock issuer, which signs the identity in. It returns
+// the callback path the browser is sent back to and the login state cookie.
+func (a *testApp) oidcLogin(issuer *mockIssuer, identity mockIdentity) (string, *http.Cookie) {
+	a.t.Helper()
+	rec := a.do(http.MethodGet, "/auth/oidc/login", "", nil, http.StatusFound)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "oidc_state" {
+			return issuer.authorize(a.t, rec.Header().Get("Location"), identity), cookie
+		}
+	}
+	a.t.Fatal("no login state cookie")
+	return "", nil
+}
+
+// oidcCallback sends the browser back to the application with the login state cookie
+func (a *testApp) oidcCallback(callback string, cookie *http.Cookie, status int) *httptest.ResponseRecorder {
+	a.t.Helper()
+	req := a.newRequest(http.MethodGet, callback, "", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return a.expect(req, status)
+}
+
+// admin logs in as the default administrator created by SyncDatabase
+func (a *testApp) admin() testUser {
+	a.t.Helper()
+	user := testUser{ID: 1, Email: "admin@example.com", Password: "admin123"}
+	user.Token = a.login(user.Email, user.Password)
+	return user
+}
+
+// createAlbum creates an album owned by the user and returns its ID
+func (a *testApp) createAlbum(user testUser, title, visibility string) uint {
+	a.t.Helper()
+	rec := a.do(http.MethodPost, "/albums", user.Token, gin.H{"title": title, "artist": "Artist", "price": 9.99, "visibility": visibility}, http.StatusCreated)
+	return decode[struct {
+		ID uint `json:"id"`
+	}](a.t, rec).ID
+}
+
+// addSong adds a YouTube video to an album and returns the song ID
+func (a *testApp) addSong(user testUser, albumID uint, videoID string) uint {
+	a.t.Helper()
+	rec := a.do(http.MethodPost, fmt.Sprintf("/albums/%d/songs", albumID), user.Token, gin.H{"youtube_url": "https://www.youtube.com/watch?v=" + videoID}, http.StatusCreated)
+	return decode[struct {
+		ID uint `json:"id"`
+	}](a.t, rec).ID
+}
+
+// publicRoutes can be called without credentials
+var publicRoutes = map[string]bool{
+	"POST /register":             true,
+	"POST /login":                true,
+	"GET /.well-known/jwks.json": true,
+	"GET /auth/oidc/login":       true,
+	"GET /auth/oidc/callback":    true,
+	"GET /public/albums":         true,
+	"GET /public/albums/:id":     true,
+	"GET /songs/:id/thumbnail":   true,
+	"GET /media/*key":            true,
+	"GET /shared/:token":         true,
+	"GET /verify-email":          true,
+	"POST /verify-email/resend":  true,
+	"POST /password/forgot":      true,
+	"POST /password/reset":       true,
+}
+
+func TestRoutesRequireAuthentication(t *testing.T) {
+	app := newTestApp(t)
+	user := app.newUser("alice")
+	albumID := app.createAlbum(user, "Private", "private")
+
+	for _, route := range app.router.Routes() {
+		name := route.Method + " " + route.Path
+		if publicRoutes[name] {
+			continue
+		}
+		path := strings.NewReplacer(":id", fmt.Sprint(albumID), ":songId", "1", ":shareId", "1", ":userId", "1",
+			":invitationId", "1", ":commentId", "1", ":entryId", "1").Replace(route.Path)
+
+		for _, credential := range []string{"", "invalid.jwt.token", "wsg_unknown"} {
+			if rec := app.serve(app.newRequest(route.Method, path, credential, nil)); rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s with credential %q: got status %d, want 401", name, credential, rec.Code)
+			}
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := newTestApp(t)
+
+	req := app.newRequest(http.MethodGet, "/public/albums", "", nil)
+	req.Header.Set("X-Request-ID", "proxy-42")
+	if id := app.expect(req, http.StatusOK).Header().Get("X-Request-ID"); id != "proxy-42" {
+		t.Errorf("request ID %q not propagated", id)
+	}
+
+	generated := app.do(http.MethodGet, "/public/albums", "", nil, http.StatusOK).Header().Get("X-Request-ID")
+	if len(generated) != 32 {
+		t.Errorf("generated request ID %q", generated)
+	}
+
+	req = app.newRequest(http.MethodGet, "/public/albums", "", nil)
+	req.Header.Set("X-Request-ID", "forged\" id")
+	if id := app.expect(req, http.StatusOK).Header().Get("X-Request-ID"); id == "forged\" id" || id == "" {
+		t.Errorf("invalid request ID %q not replaced", id)
+	}
+}
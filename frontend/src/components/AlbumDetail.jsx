@@ -234,10 +234,10 @@ const AlbumDetail = () => {
                     gap: '15px'
                   }}
                 >
-                  {song.thumbnail_url && (
+                  {song.cached_thumbnail_url && (
                     <div style={{ flexShrink: 0 }}>
                       <img 
-                        src={song.thumbnail_url} 
+                        src={songsAPI.thumbnailUrl(song)} 
                         alt={song.title}
                         style={{
                           width: '120px',
@@ -1,5 +1,5 @@
 import React, { useState } from 'react'
-import { useNavigate, Link } from 'react-router-dom'
+import { Link } from 'react-router-dom'
 import { useAuth } from '../context/AuthContext'
 
 const Register = () => {
@@ -7,13 +7,14 @@ const Register = () => {
   const [password, setPassword] = useState('')
   const [name, setName] = useState('')
   const [error, setError] = useState('')
+  const [message, setMessage] = useState('')
   const [loading, setLoading] = useState(false)
   const { register } = useAuth()
-  const navigate = useNavigate()
 
   const handleSubmit = async (e) => {
     e.preventDefault()
     setError('')
+    setMessage('')
 
     if (password.length < 6) {
       setError('Password must contain at least 6 characters')
@@ -25,7 +26,7 @@ const Register = () => {
     const result = await register(email, password, name)
     
     if (result.success) {
-      navigate('/albums')
+      setMessage(result.message)
     } else {
       setError(result.error)
     }
@@ -77,6 +78,7 @@ const Register = () => {
             </div>
 
             {error && <div className="error">{error}</div>}
+            {message && <div className="success">{message}</div>}
 
             <button
               type="submit"
@@ -54,11 +54,9 @@ export const AuthProvider = ({ children }) => {
 
   const register = async (email, password, name) => {
     try {
+      // The account must be verified by email before the user can log in
       const data = await authAPI.register(email, password, name)
-      localStorage.setItem('token', data.token)
-      localStorage.setItem('user', JSON.stringify(data.user))
-      setUser(data.user)
-      return { success: true }
+      return { success: true, message: data.message }
     } catch (error) {
       return {
         success: false,
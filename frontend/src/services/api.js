@@ -1,6 +1,6 @@
 import axios from 'axios'
 
-const API_URL = 'http://localhost:8082'
+export const API_URL = 'http://localhost:8082'
 
 const api = axios.create({
   baseURL: API_URL,
@@ -105,6 +105,10 @@ export const songsAPI = {
     const response = await api.delete(`/albums/${albumId}/songs/${songId}`)
     return response.data
   },
+
+  // Thumbnails are served through the API so the browser never contacts YouTube.
+  // The album details give each song a signed URL, since <img> tags send no token.
+  thumbnailUrl: (song) => `${API_URL}${song.cached_thumbnail_url}`,
 }
 
 export default api
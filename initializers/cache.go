@@ -0,0 +1,63 @@
+package initializers
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"example/web-service-gin/utils"
+)
+
+// ConfigureCache sets up the YouTube metadata cache: in memory with YOUTUBE_CACHE_SIZE
+// entries by default, or in Redis when REDIS_URL is set. Entries expire after YOUTUBE_CACHE_TTL.
+func ConfigureCache() *utils.VideoInfoCache {
+	ttl := 24 * time.Hour
+	if value := os.Getenv("YOUTUBE_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			fatal("YOUTUBE_CACHE_TTL must be a positive duration such as 12h")
+		}
+		ttl = parsed
+	}
+
+	var cache utils.Cache
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		redis, err := utils.NewRedisCache(redisURL)
+		if err != nil {
+			fatal("Invalid REDIS_URL", "error", err)
+		}
+		cache = redis
+		slog.Info("Caching YouTube metadata in Redis", "addr", redis.Addr)
+	} else {
+		size := 1000
+		if value := os.Getenv("YOUTUBE_CACHE_SIZE"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				fatal("YOUTUBE_CACHE_SIZE must be a positive number of entries")
+			}
+			size = parsed
+		}
+		cache = utils.NewLRUCache(size)
+	}
+
+	return &utils.VideoInfoCache{
+		Cache: cache,
+		TTL:   ttl,
+		Fetch: videoInfoProvider().GetVideoInfo,
+	}
+}
+
+// videoInfoProvider uses the YouTube Data API when YOUTUBE_API_KEY is set, with the
+// scraper as fallback, and only the scraper otherwise
+func videoInfoProvider() utils.VideoInfoProvider {
+	apiKey := os.Getenv("YOUTUBE_API_KEY")
+	if apiKey == "" {
+		return utils.ScraperProvider{}
+	}
+	slog.Info("Using the YouTube Data API for video information")
+	return &utils.FallbackProvider{
+		Primary:  utils.NewYouTubeDataAPI(apiKey),
+		Fallback: utils.ScraperProvider{},
+	}
+}
@@ -1,77 +1,109 @@
 package initializers
 
 import (
-	"log"
+	"log/slog"
+	"time"
 
 	"example/web-service-gin/models"
+	"example/web-service-gin/utils"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// ConnectDB opens the database. Its statements are logged at debug level, and at
+// warn level when slower than DB_SLOW_QUERY_THRESHOLD (200ms by default).
+func ConnectDB() *gorm.DB {
+	logger := &utils.GormLogger{
+		Logger:        slog.Default(),
+		SlowThreshold: durationEnv("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+	}
 
-func ConnectDB() {
-	var err error
-	DB, err = gorm.Open(sqlite.Open("albums.db"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open("albums.db"), &gorm.Config{Logger: logger})
 	if err != nil {
-		log.Fatal("Unable to connect to database")
+		fatal("Unable to connect to database", "error", err)
 	}
 
-	log.Println("Database connection successful")
+	slog.Info("Database connection successful")
+	return db
 }
 
-func SyncDatabase() {
-	err := DB.AutoMigrate(&models.Album{}, &models.User{}, &models.Tag{}, &models.Song{})
+func SyncDatabase(db *gorm.DB) {
+	// Accounts created before email verification existed are considered verified
+	backfillVerification := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+	// The default user of databases created before admins existed becomes the admin
+	backfillAdmin := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "IsAdmin")
+
+	err := db.AutoMigrate(
+		&models.Album{}, &models.User{}, &models.Tag{}, &models.Song{},
+		&models.UserToken{}, &models.UserIdentity{}, &models.APIKey{},
+		&models.AlbumShare{}, &models.AlbumMember{}, &models.AlbumInvitation{},
+		&models.Playlist{}, &models.PlaylistEntry{},
+		&models.AlbumFavourite{}, &models.SongLike{}, &models.AlbumRating{},
+		&models.Comment{}, &models.CommentRevision{},
+		&models.Follow{}, &models.Activity{},
+		&models.AlbumTrack{},
+	)
 	if err != nil {
-		log.Fatal("Error during database migration")
+		fatal("Error during database migration", "error", err)
+	}
+
+	if backfillVerification {
+		db.Model(&models.User{}).Where("email_verified_at IS NULL").Update("email_verified_at", time.Now())
 	}
 
 	// Create a default user if it doesn't exist
 	var defaultUser models.User
 	var userCount int64
-	DB.Model(&models.User{}).Count(&userCount)
+	db.Model(&models.User{}).Count(&userCount)
 
 	if userCount == 0 {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
 		if err != nil {
-			log.Fatal("Error hashing default password")
+			fatal("Error hashing default password", "error", err)
 		}
 
+		now := time.Now()
 		defaultUser = models.User{
-			Email:    "admin@example.com",
-			Password: string(hashedPassword),
-			Name:     "Administrator",
+			Email:           "admin@example.com",
+			Password:        string(hashedPassword),
+			Name:            "Administrator",
+			EmailVerifiedAt: &now,
+			IsAdmin:         true,
 		}
 
-		if err := DB.Create(&defaultUser).Error; err != nil {
-			log.Fatal("Error creating default user")
+		if err := db.Create(&defaultUser).Error; err != nil {
+			fatal("Error creating default user", "error", err)
 		}
-		log.Println("Default user created: admin@example.com / admin123")
+		slog.Info("Default user created: admin@example.com / admin123")
 	} else {
 		// Retrieve the first user as default user
-		if err := DB.First(&defaultUser).Error; err != nil {
-			log.Fatal("Error retrieving default user")
+		if err := db.First(&defaultUser).Error; err != nil {
+			fatal("Error retrieving default user", "error", err)
 		}
 	}
 
+	if backfillAdmin {
+		db.Model(&defaultUser).Update("is_admin", true)
+	}
+
 	// Update existing albums without UserID to associate them with the default user
 	userID := defaultUser.ID
-	DB.Model(&models.Album{}).Where("user_id IS NULL").Update("user_id", userID)
+	db.Model(&models.Album{}).Where("user_id IS NULL").Update("user_id", userID)
 
 	// Create seed albums if they don't exist
 	var count int64
-	DB.Model(&models.Album{}).Count(&count)
+	db.Model(&models.Album{}).Count(&count)
 	if count == 0 {
 		seedAlbums := []models.Album{
-			{Title: "Blue Train", Artist: "John Coltrane", Price: 56.99, UserID: &userID},
-			{Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99, UserID: &userID},
-			{Title: "Sarah Vaughan and Clifford Brown", Artist: "Sarah Vaughan", Price: 39.99, UserID: &userID},
+			{Title: "Blue Train", Artist: "John Coltrane", Price: 56.99, Visibility: models.VisibilityPublic, UserID: &userID},
+			{Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99, Visibility: models.VisibilityPublic, UserID: &userID},
+			{Title: "Sarah Vaughan and Clifford Brown", Artist: "Sarah Vaughan", Price: 39.99, Visibility: models.VisibilityPublic, UserID: &userID},
 		}
-		if err := DB.Create(&seedAlbums).Error; err != nil {
-			log.Fatal("Error creating seed data")
+		if err := db.Create(&seedAlbums).Error; err != nil {
+			fatal("Error creating seed data", "error", err)
 		}
-		log.Println("Seed data initialized with default user")
+		slog.Info("Seed data initialized with default user")
 	}
 }
@@ -0,0 +1,45 @@
+package initializers
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"example/web-service-gin/utils"
+)
+
+// ConfigureHTTPClient applies the HTTP_* settings to the client shared by all calls
+// to external services (YouTube, MusicBrainz, the OIDC provider, S3)
+func ConfigureHTTPClient() {
+	config := utils.DefaultOutboundConfig
+	config.Timeout = durationEnv("HTTP_TIMEOUT", config.Timeout)
+	config.Cooldown = durationEnv("HTTP_CIRCUIT_COOLDOWN", config.Cooldown)
+	config.MaxRetries = intEnv("HTTP_MAX_RETRIES", config.MaxRetries)
+	config.FailureThreshold = intEnv("HTTP_CIRCUIT_THRESHOLD", config.FailureThreshold)
+
+	utils.HTTPClient = utils.NewOutboundClient(config)
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		fatal(name+" must be a positive duration such as 10s", "value", value)
+	}
+	return d
+}
+
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		fatal(name+" must be a non-negative number", "value", value)
+	}
+	return n
+}
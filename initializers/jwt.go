@@ -0,0 +1,129 @@
+package initializers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"example/web-service-gin/utils"
+)
+
+// LoadJWTKeys configures token signing from the environment. It must run after LoadEnvVariables.
+//
+// With JWT_PRIVATE_KEYS set ("kid=path.pem,kid=path.pem"), tokens are signed with the
+// first RSA (RS256) or Ed25519 (EdDSA) key and the others, plus JWT_PUBLIC_KEYS, are
+// still accepted so keys can be rotated. Otherwise tokens are signed with HS256 using
+// JWT_SECRET (kid JWT_SECRET_KID) and JWT_PREVIOUS_SECRETS ("kid=secret,...") remain valid.
+//
+// Missing or weak secrets are refused unless APP_ENV=development.
+func LoadJWTKeys() {
+	var err error
+	if os.Getenv("JWT_PRIVATE_KEYS") != "" {
+		err = loadAsymmetricKeys()
+	} else {
+		err = loadHMACKeys()
+	}
+	if err != nil {
+		fatal("Invalid JWT configuration", "error", err)
+	}
+}
+
+// IsDevMode reports whether the application runs in development mode
+func IsDevMode() bool {
+	return os.Getenv("APP_ENV") == "development"
+}
+
+func loadAsymmetricKeys() error {
+	privateKeys, err := parseKeyList(os.Getenv("JWT_PRIVATE_KEYS"))
+	if err != nil {
+		return fmt.Errorf("JWT_PRIVATE_KEYS: %v", err)
+	}
+	publicKeys, err := parseKeyList(os.Getenv("JWT_PUBLIC_KEYS"))
+	if err != nil {
+		return fmt.Errorf("JWT_PUBLIC_KEYS: %v", err)
+	}
+	if len(privateKeys) == 0 {
+		return fmt.Errorf("JWT_PRIVATE_KEYS does not contain any key")
+	}
+
+	var keys []utils.JWTKey
+	for _, entry := range privateKeys {
+		key, err := utils.LoadPrivateKeyPEM(entry[0], entry[1])
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	for _, entry := range publicKeys {
+		key, err := utils.LoadPublicKeyPEM(entry[0], entry[1])
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := utils.SetJWTKeys(keys[0], keys[1:]...); err != nil {
+		return err
+	}
+	slog.Info("JWT signing key loaded", "alg", keys[0].Method.Alg(), "kid", keys[0].ID, "verification_keys", len(keys))
+	return nil
+}
+
+func loadHMACKeys() error {
+	secret := os.Getenv("JWT_SECRET")
+	if err := utils.ValidateJWTSecret(secret); err != nil {
+		if !IsDevMode() {
+			return fmt.Errorf("%v (set APP_ENV=development to allow this locally)", err)
+		}
+		if secret == "" {
+			// Tokens will not survive a restart, which is acceptable in development
+			b := make([]byte, utils.MinJWTSecretLength)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			secret = string(b)
+			slog.Warn("JWT_SECRET not set, using a random secret for this run (development mode)")
+		} else {
+			slog.Warn("Weak JWT secret allowed in development mode", "error", err)
+		}
+	}
+
+	kid := os.Getenv("JWT_SECRET_KID")
+	if kid == "" {
+		kid = "hs256-1"
+	}
+
+	previous, err := parseKeyList(os.Getenv("JWT_PREVIOUS_SECRETS"))
+	if err != nil {
+		return fmt.Errorf("JWT_PREVIOUS_SECRETS: %v", err)
+	}
+
+	var verifyOnly []utils.JWTKey
+	for _, entry := range previous {
+		if err := utils.ValidateJWTSecret(entry[1]); err != nil && !IsDevMode() {
+			return fmt.Errorf("previous secret %q: %v", entry[0], err)
+		}
+		verifyOnly = append(verifyOnly, utils.NewHMACKey(entry[0], []byte(entry[1])))
+	}
+
+	return utils.SetJWTKeys(utils.NewHMACKey(kid, []byte(secret)), verifyOnly...)
+}
+
+// parseKeyList parses "kid=value,kid=value" into ordered pairs
+func parseKeyList(value string) ([][2]string, error) {
+	var entries [][2]string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kid, v, ok := strings.Cut(item, "=")
+		if !ok || kid == "" || v == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected kid=value", item)
+		}
+		entries = append(entries, [2]string{strings.TrimSpace(kid), strings.TrimSpace(v)})
+	}
+	return entries, nil
+}
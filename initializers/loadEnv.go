@@ -1,15 +1,18 @@
 package initializers
 
 import (
-	"log"
+	"log/slog"
 
 	"github.com/joho/godotenv"
 )
 
+// LoadEnvVariables loads the .env file, then configures the logger since
+// LOG_LEVEL may be set there
 func LoadEnvVariables() {
 	err := godotenv.Load()
+	ConfigureLogger()
 	if err != nil {
-		log.Println("No .env file found, using default values")
+		slog.Info("No .env file found, using default values")
 	}
 }
 
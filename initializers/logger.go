@@ -0,0 +1,29 @@
+package initializers
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"example/web-service-gin/utils"
+)
+
+// ConfigureLogger makes the default logger write JSON lines to the standard output,
+// at the level set by LOG_LEVEL (debug, info, warn or error, info by default).
+// Lines written with the standard log package go through it as well.
+func ConfigureLogger() {
+	level := slog.LevelInfo
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(strings.ToUpper(value))); err != nil {
+			fatal("LOG_LEVEL must be debug, info, warn or error", "value", value)
+		}
+	}
+
+	slog.SetDefault(utils.NewLogger(os.Stdout, level))
+}
+
+// fatal logs an error that prevents the server from starting and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
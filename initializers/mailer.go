@@ -0,0 +1,38 @@
+package initializers
+
+import (
+	"log/slog"
+	"os"
+
+	"example/web-service-gin/utils"
+)
+
+// ConnectMailer configures the SMTP mailer when SMTP_HOST is set,
+// otherwise emails are written to MAIL_LOG_FILE (or the log) for local development
+func ConnectMailer() utils.Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		slog.Warn("SMTP_HOST not set, emails will be logged instead of sent")
+		return &utils.LogMailer{Path: os.Getenv("MAIL_LOG_FILE")}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	mailer := &utils.SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+	slog.Info("SMTP mailer configured", "host", host, "port", port)
+	return mailer
+}
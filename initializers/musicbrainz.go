@@ -0,0 +1,29 @@
+package initializers
+
+import (
+	"log/slog"
+	"os"
+
+	"example/web-service-gin/utils"
+)
+
+// ConfigureMetadata enables album enrichment from MusicBrainz when MUSICBRAINZ_USER_AGENT is set.
+// MusicBrainz requires a user agent identifying the application and a contact,
+// e.g. "MyAlbums/1.0 ( admin@example.com )". It returns nil when enrichment is disabled.
+func ConfigureMetadata() utils.MetadataClient {
+	userAgent := os.Getenv("MUSICBRAINZ_USER_AGENT")
+	if userAgent == "" {
+		return nil
+	}
+
+	client := utils.NewMusicBrainzClient(userAgent)
+	if baseURL := os.Getenv("MUSICBRAINZ_URL"); baseURL != "" {
+		client.BaseURL = baseURL
+	}
+	if coverArtURL := os.Getenv("COVER_ART_ARCHIVE_URL"); coverArtURL != "" {
+		client.CoverArtURL = coverArtURL
+	}
+
+	slog.Info("Album enrichment enabled with MusicBrainz", "url", client.BaseURL)
+	return client
+}
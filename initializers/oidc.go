@@ -0,0 +1,43 @@
+package initializers
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"example/web-service-gin/utils"
+)
+
+// ConfigureOIDC enables OpenID Connect login when OIDC_ISSUER_URL is set.
+// It returns nil when no external identity provider is configured.
+func ConfigureOIDC() *utils.OIDCProvider {
+	issuer := os.Getenv("OIDC_ISSUER_URL")
+	if issuer == "" {
+		return nil
+	}
+
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		fatal("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set")
+	}
+
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = "http://localhost:8082/auth/oidc/callback"
+	}
+
+	var scopes []string
+	if s := os.Getenv("OIDC_SCOPES"); s != "" {
+		scopes = strings.Fields(s)
+	}
+
+	provider := &utils.OIDCProvider{
+		IssuerURL:    issuer,
+		ClientID:     clientID,
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+	slog.Info("OIDC login enabled", "issuer", issuer)
+	return provider
+}
@@ -0,0 +1,40 @@
+package initializers
+
+import (
+	"log/slog"
+	"os"
+
+	"example/web-service-gin/utils"
+)
+
+// ConfigureStorage selects where uploaded files such as album covers are kept: STORAGE_DRIVER=local (default)
+// writes below STORAGE_LOCAL_DIR, STORAGE_DRIVER=s3 uses an S3-compatible bucket
+func ConfigureStorage() utils.Storage {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		root := os.Getenv("STORAGE_LOCAL_DIR")
+		if root == "" {
+			root = "uploads"
+		}
+		return &utils.LocalStorage{Root: root}
+	case "s3":
+		s3 := &utils.S3Storage{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		}
+		if s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			fatal("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required when STORAGE_DRIVER is s3")
+		}
+		if s3.Region == "" {
+			s3.Region = "us-east-1"
+		}
+		slog.Info("Storing uploads in S3", "bucket", s3.Bucket, "endpoint", s3.Endpoint)
+		return s3
+	default:
+		fatal("Unknown STORAGE_DRIVER, expected 'local' or 's3'", "driver", driver)
+		return nil
+	}
+}
@@ -0,0 +1,34 @@
+package initializers
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"example/web-service-gin/utils"
+)
+
+// ConfigureThumbnailCache sets up the disk cache of the song thumbnails served by
+// GET /songs/:id/thumbnail in THUMBNAIL_CACHE_DIR, limited to THUMBNAIL_CACHE_MAX_MB megabytes
+func ConfigureThumbnailCache() *utils.ThumbnailCache {
+	dir := os.Getenv("THUMBNAIL_CACHE_DIR")
+	if dir == "" {
+		dir = "cache/thumbnails"
+	}
+
+	maxMB := int64(100)
+	if value := os.Getenv("THUMBNAIL_CACHE_MAX_MB"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			fatal("THUMBNAIL_CACHE_MAX_MB must be a positive number of megabytes")
+		}
+		maxMB = parsed
+	}
+
+	return &utils.ThumbnailCache{
+		Dir:      dir,
+		MaxBytes: maxMB << 20,
+		TTL:      24 * time.Hour,
+		MaxImage: 2 << 20,
+	}
+}
@@ -4,25 +4,49 @@ import (
 	"example/web-service-gin/controllers"
 	"example/web-service-gin/initializers"
 	"example/web-service-gin/middleware"
+	"example/web-service-gin/models"
+	"example/web-service-gin/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-func init() {
+func main() {
 	initializers.LoadEnvVariables()
-	initializers.ConnectDB()
-	initializers.SyncDatabase()
+	initializers.LoadJWTKeys()
+	initializers.ConfigureHTTPClient()
+
+	db := initializers.ConnectDB()
+	initializers.SyncDatabase(db)
+
+	handler := &controllers.Handler{
+		DB:           db,
+		Repositories: repository.NewGormRepositories(db),
+		Mailer:       initializers.ConnectMailer(),
+		OIDC:         initializers.ConfigureOIDC(),
+		Metadata:     initializers.ConfigureMetadata(),
+		Storage:      initializers.ConfigureStorage(),
+		Thumbnails:   initializers.ConfigureThumbnailCache(),
+		VideoInfo:    initializers.ConfigureCache(),
+		// Comment moderation hooks, e.g. a spam filter, are registered here
+		CommentHooks: []controllers.CommentModerationHook{},
+	}
+
+	router := setupRouter(handler)
+	router.Run("localhost:8082")
 }
 
-func main() {
-	router := gin.Default()
+// setupRouter builds the router with every route of the API, served by h.
+func setupRouter(h *controllers.Handler) *gin.Engine {
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.RequestLogger(), middleware.Recovery())
 
 	// CORS configuration to allow requests from the frontend
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -33,28 +57,116 @@ func main() {
 	})
 
 	// Public routes
-	router.POST("/register", controllers.Register)
-	router.POST("/login", controllers.Login)
+	router.POST("/register", h.Register)
+	router.POST("/login", h.Login)
+	router.GET("/.well-known/jwks.json", h.GetJWKS)
+	router.GET("/auth/oidc/login", h.OIDCLogin)
+	router.GET("/auth/oidc/callback", h.OIDCCallback)
+	router.GET("/public/albums", h.GetPublicAlbums)
+	router.GET("/public/albums/:id", h.GetPublicAlbumByID)
+	router.GET("/songs/:id/thumbnail", h.GetSongThumbnail)
+	router.GET("/media/*key", h.GetMedia)
+	router.GET("/shared/:token", h.GetSharedAlbum)
+	router.GET("/verify-email", h.VerifyEmail)
+	router.POST("/verify-email/resend", h.ResendVerification)
+	router.POST("/password/forgot", h.ForgotPassword)
+	router.POST("/password/reset", h.ResetPassword)
 
-	// Routes protected by authentication
+	// Routes protected by authentication, also reachable with an API key holding the route's scope
 	protected := router.Group("/")
-	protected.Use(middleware.RequireAuth())
+	protected.Use(middleware.RequireAuth(h.DB))
 	{
-		protected.GET("/albums", controllers.GetAlbums)
-		protected.GET("/all-albums", controllers.GetAllAlbums)
-		protected.GET("/albums/:id", controllers.GetAlbumByID)
-		protected.POST("/albums", controllers.PostAlbums)
-		protected.GET("/profile", controllers.GetProfile)
+		protected.GET("/albums", middleware.RequireScope(models.ScopeAlbumsRead), h.GetAlbums)
+		protected.GET("/all-albums", middleware.RequireScope(models.ScopeAlbumsRead), h.GetAllAlbums)
+		protected.GET("/albums/:id", middleware.RequireScope(models.ScopeAlbumsRead), h.GetAlbumByID)
+		protected.POST("/albums", middleware.RequireScope(models.ScopeAlbumsWrite), h.PostAlbums)
+		protected.PATCH("/albums/:id", middleware.RequireScope(models.ScopeAlbumsWrite), h.UpdateAlbum)
+		protected.POST("/albums/:id/shares", middleware.RequireScope(models.ScopeAlbumsWrite), h.CreateAlbumShare)
+		protected.GET("/albums/:id/shares", middleware.RequireScope(models.ScopeAlbumsRead), h.GetAlbumShares)
+		protected.DELETE("/albums/:id/shares/:shareId", middleware.RequireScope(models.ScopeAlbumsWrite), h.RevokeAlbumShare)
+
+		// Album member routes
+		protected.GET("/albums/:id/members", middleware.RequireScope(models.ScopeAlbumsRead), h.GetAlbumMembers)
+		protected.PATCH("/albums/:id/members/:userId", middleware.RequireScope(models.ScopeAlbumsWrite), h.UpdateAlbumMember)
+		protected.DELETE("/albums/:id/members/:userId", middleware.RequireScope(models.ScopeAlbumsWrite), h.RemoveAlbumMember)
+		protected.POST("/albums/:id/invitations", middleware.RequireScope(models.ScopeAlbumsWrite), h.InviteAlbumMember)
+		protected.GET("/albums/:id/invitations", middleware.RequireScope(models.ScopeAlbumsRead), h.GetAlbumInvitations)
+		protected.DELETE("/albums/:id/invitations/:invitationId", middleware.RequireScope(models.ScopeAlbumsWrite), h.RevokeAlbumInvitation)
 
 		// Tag routes
-		protected.GET("/tags", controllers.GetTags)
-		protected.POST("/tags", controllers.CreateTag)
+		protected.GET("/tags", middleware.RequireScope(models.ScopeTagsRead), h.GetTags)
+		protected.POST("/tags", middleware.RequireScope(models.ScopeTagsWrite), h.CreateTag)
+
+		protected.POST("/albums/:id/enrich", middleware.RequireScope(models.ScopeAlbumsWrite), h.EnrichAlbum)
+		protected.POST("/albums/:id/cover", middleware.RequireScope(models.ScopeAlbumsWrite), h.UploadAlbumCover)
+		protected.DELETE("/albums/:id/cover", middleware.RequireScope(models.ScopeAlbumsWrite), h.DeleteAlbumCover)
 
 		// Song routes
-		protected.POST("/albums/:id/songs", controllers.AddSongToAlbum)
-		protected.GET("/albums/:id/songs", controllers.GetSongsByAlbum)
-		protected.DELETE("/albums/:id/songs/:songId", controllers.DeleteSong)
+		protected.POST("/albums/:id/songs", middleware.RequireScope(models.ScopeSongsWrite), h.AddSongToAlbum)
+		protected.GET("/albums/:id/songs", middleware.RequireScope(models.ScopeSongsRead), h.GetSongsByAlbum)
+		protected.DELETE("/albums/:id/songs/:songId", middleware.RequireScope(models.ScopeSongsWrite), h.DeleteSong)
+
+		// Favourite, like and rating routes
+		protected.PUT("/albums/:id/favourite", middleware.RequireScope(models.ScopeAlbumsWrite), h.FavouriteAlbum)
+		protected.DELETE("/albums/:id/favourite", middleware.RequireScope(models.ScopeAlbumsWrite), h.UnfavouriteAlbum)
+		protected.PUT("/albums/:id/rating", middleware.RequireScope(models.ScopeAlbumsWrite), h.RateAlbum)
+		protected.DELETE("/albums/:id/rating", middleware.RequireScope(models.ScopeAlbumsWrite), h.DeleteAlbumRating)
+		protected.PUT("/albums/:id/songs/:songId/like", middleware.RequireScope(models.ScopeSongsWrite), h.LikeSong)
+		protected.DELETE("/albums/:id/songs/:songId/like", middleware.RequireScope(models.ScopeSongsWrite), h.UnlikeSong)
+		protected.GET("/favourites/albums", middleware.RequireScope(models.ScopeAlbumsRead), h.GetFavouriteAlbums)
+		protected.GET("/favourites/songs", middleware.RequireScope(models.ScopeSongsRead), h.GetLikedSongs)
+
+		// Comment routes
+		protected.GET("/albums/:id/comments", middleware.RequireScope(models.ScopeAlbumsRead), h.GetAlbumComments)
+		protected.POST("/albums/:id/comments", middleware.RequireScope(models.ScopeAlbumsWrite), h.CreateAlbumComment)
+		protected.PATCH("/albums/:id/comments/:commentId", middleware.RequireScope(models.ScopeAlbumsWrite), h.UpdateAlbumComment)
+		protected.DELETE("/albums/:id/comments/:commentId", middleware.RequireScope(models.ScopeAlbumsWrite), h.DeleteAlbumComment)
+		protected.GET("/albums/:id/comments/:commentId/history", middleware.RequireScope(models.ScopeAlbumsRead), h.GetAlbumCommentHistory)
+
+		// Library export and import
+		protected.GET("/export", middleware.RequireScope(models.ScopeAlbumsRead), middleware.RequireScope(models.ScopeSongsRead), h.ExportLibrary)
+		protected.POST("/import", middleware.RequireScope(models.ScopeAlbumsWrite), middleware.RequireScope(models.ScopeSongsWrite), middleware.RequireScope(models.ScopeTagsWrite), h.ImportLibrary)
+
+		// Playlist routes
+		protected.GET("/playlists", middleware.RequireScope(models.ScopePlaylistsRead), h.GetPlaylists)
+		protected.POST("/playlists", middleware.RequireScope(models.ScopePlaylistsWrite), h.CreatePlaylist)
+		protected.GET("/playlists/:id", middleware.RequireScope(models.ScopePlaylistsRead), h.GetPlaylistByID)
+		protected.PATCH("/playlists/:id", middleware.RequireScope(models.ScopePlaylistsWrite), h.UpdatePlaylist)
+		protected.DELETE("/playlists/:id", middleware.RequireScope(models.ScopePlaylistsWrite), h.DeletePlaylist)
+		protected.POST("/playlists/:id/songs", middleware.RequireScope(models.ScopePlaylistsWrite), h.AddSongToPlaylist)
+		protected.DELETE("/playlists/:id/songs/:entryId", middleware.RequireScope(models.ScopePlaylistsWrite), h.RemoveSongFromPlaylist)
+		protected.POST("/playlists/:id/songs/:entryId/move", middleware.RequireScope(models.ScopePlaylistsWrite), h.MovePlaylistEntry)
+		protected.PUT("/playlists/:id/order", middleware.RequireScope(models.ScopePlaylistsWrite), h.ReorderPlaylist)
+		protected.GET("/playlists/:id/export", middleware.RequireScope(models.ScopePlaylistsRead), h.ExportPlaylist)
 	}
 
-	router.Run("localhost:8082")
+	// Account routes, only reachable by a logged in user
+	session := router.Group("/")
+	session.Use(middleware.RequireAuth(h.DB), middleware.RequireSession())
+	{
+		session.GET("/profile", h.GetProfile)
+		session.PATCH("/profile", h.UpdateProfile)
+		session.POST("/profile/password", h.ChangePassword)
+		session.DELETE("/profile", h.DeleteProfile)
+
+		// API key routes
+		session.POST("/api-keys", h.CreateAPIKey)
+		session.GET("/api-keys", h.GetAPIKeys)
+		session.DELETE("/api-keys/:id", h.RevokeAPIKey)
+
+		// Invitation routes
+		session.POST("/invitations/accept", h.AcceptInvitation)
+
+		// Admin routes
+		session.GET("/admin/metrics", h.GetMetrics)
+
+		// Follow and feed routes
+		session.PUT("/users/:id/follow", h.FollowUser)
+		session.DELETE("/users/:id/follow", h.UnfollowUser)
+		session.GET("/following", h.GetFollowing)
+		session.GET("/followers", h.GetFollowers)
+		session.GET("/feed", h.GetFeed)
+	}
+
+	return router
 }
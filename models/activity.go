@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Activity types shown in the feed
+const (
+	ActivityAlbumCreated = "album_created"
+	ActivitySongAdded    = "song_added"
+	ActivityAlbumRated   = "album_rated"
+	ActivityTagCreated   = "tag_created"
+)
+
+// Activity is an event in a user's activity stream, shown in the feed of their followers.
+// Depending on the type it refers to an album, a song of that album or a tag.
+type Activity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Type      string    `gorm:"not null" json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// The user who did something
+	UserID uint  `gorm:"index;not null" json:"user_id"`
+	User   *User `gorm:"foreignKey:UserID" json:"actor,omitempty"`
+
+	AlbumID *uint  `gorm:"index" json:"album_id,omitempty"`
+	Album   *Album `gorm:"foreignKey:AlbumID" json:"album,omitempty"`
+	SongID  *uint  `gorm:"index" json:"song_id,omitempty"`
+	Song    *Song  `gorm:"foreignKey:SongID" json:"song,omitempty"`
+	TagID   *uint  `gorm:"index" json:"tag_id,omitempty"`
+	Tag     *Tag   `gorm:"foreignKey:TagID" json:"tag,omitempty"`
+
+	// Score of an album_rated activity
+	Score int `json:"score,omitempty"`
+}
@@ -1,11 +1,46 @@
 package models
 
+import (
+	"path"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Visibility levels of an album
+const (
+	// VisibilityPrivate albums are only visible to their owner
+	VisibilityPrivate = "private"
+	// VisibilityUnlisted albums are only reachable through a share link
+	VisibilityUnlisted = "unlisted"
+	// VisibilityPublic albums are listed for everyone, including anonymous visitors
+	VisibilityPublic = "public"
+)
+
+// IsValidVisibility reports whether v is a known visibility level
+func IsValidVisibility(v string) bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
 // Album represents data about a record album.
 type Album struct {
-	ID     uint    `gorm:"primaryKey" json:"id"`
-	Title  string  `json:"title"`
-	Artist string  `json:"artist"`
-	Price  float64 `json:"price"`
+	ID         uint    `gorm:"primaryKey" json:"id"`
+	Title      string  `json:"title"`
+	Artist     string  `json:"artist"`
+	Price      float64 `json:"price"`
+	Visibility string  `gorm:"not null;default:private;index" json:"visibility"`
+
+	// Metadata filled in by MusicBrainz enrichment
+	MBID        string     `gorm:"column:mbid;index" json:"mbid,omitempty"`
+	ReleaseYear int        `json:"release_year,omitempty"`
+	Label       string     `json:"label,omitempty"`
+	CoverArtURL string     `json:"cover_art_url,omitempty"`
+	EnrichedAt  *time.Time `json:"enriched_at,omitempty"`
+
+	// CoverKey is the storage key of the uploaded cover; its thumbnails are stored next to it
+	CoverKey    string            `json:"-"`
+	CoverImages map[string]string `gorm:"-" json:"cover_images,omitempty"`
 
 	// One-to-many relation: A user can have multiple albums
 	UserID *uint `json:"user_id,omitempty"`
@@ -16,4 +51,32 @@ type Album struct {
 
 	// One-to-many relation: An album can have multiple songs
 	Songs []Song `gorm:"foreignKey:AlbumID" json:"songs,omitempty"`
+
+	// One-to-many relation: The track listing of the release, from enrichment
+	Tracks []AlbumTrack `gorm:"foreignKey:AlbumID" json:"tracks,omitempty"`
+
+	// Aggregated statistics, computed when the album is returned
+	AverageRating  float64 `gorm:"-" json:"average_rating"`
+	RatingCount    int64   `gorm:"-" json:"rating_count"`
+	FavouriteCount int64   `gorm:"-" json:"favourite_count"`
+}
+
+// CoverThumbnailSizes are the maximum widths and heights of the generated cover thumbnails
+var CoverThumbnailSizes = []int{150, 300, 600}
+
+// CoverThumbnailKey returns the storage key of a cover thumbnail
+func CoverThumbnailKey(coverKey string, size int) string {
+	return path.Dir(coverKey) + "/" + strconv.Itoa(size) + ".jpg"
+}
+
+// AfterFind fills in the URLs of the uploaded cover and its thumbnails
+func (a *Album) AfterFind(tx *gorm.DB) error {
+	if a.CoverKey == "" {
+		return nil
+	}
+	a.CoverImages = map[string]string{"original": "/media/" + a.CoverKey}
+	for _, size := range CoverThumbnailSizes {
+		a.CoverImages[strconv.Itoa(size)] = "/media/" + CoverThumbnailKey(a.CoverKey, size)
+	}
+	return nil
 }
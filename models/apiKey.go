@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scopes that can be granted to an API key
+const (
+	ScopeAlbumsRead  = "albums:read"
+	ScopeAlbumsWrite = "albums:write"
+	ScopeSongsRead   = "songs:read"
+	ScopeSongsWrite  = "songs:write"
+	ScopeTagsRead    = "tags:read"
+	ScopeTagsWrite   = "tags:write"
+
+	ScopePlaylistsRead  = "playlists:read"
+	ScopePlaylistsWrite = "playlists:write"
+)
+
+// AllScopes lists every scope accepted when creating an API key
+var AllScopes = []string{
+	ScopeAlbumsRead, ScopeAlbumsWrite,
+	ScopeSongsRead, ScopeSongsWrite,
+	ScopeTagsRead, ScopeTagsWrite,
+	ScopePlaylistsRead, ScopePlaylistsWrite,
+}
+
+// APIKey is a personal key used by scripts to authenticate as a user.
+// Only the SHA-256 hash of the key is stored; revoked keys are soft deleted.
+type APIKey struct {
+	gorm.Model
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null" json:"prefix"`
+	KeyHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"not null" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	// One-to-many relation: A user can have multiple API keys
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// ScopeList returns the scopes granted to the key
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// IsExpired reports whether the key has an expiry date in the past
+func (k *APIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+// IsValidScope reports whether scope is one of AllScopes
+func IsValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
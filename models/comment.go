@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Comment is a message in an album's discussion thread. Replies point to their
+// parent comment. Deleted comments keep their place in the thread with an empty body.
+type Comment struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Body      string     `gorm:"not null" json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+
+	// Soft delete, kept apart from gorm.DeletedAt so deleted comments still show in threads
+	DeletedAt        *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	DeletedByID      *uint      `json:"-"`
+	ModerationReason string     `json:"moderation_reason,omitempty"`
+
+	// One-to-many relation: An album can have multiple comments
+	AlbumID uint  `gorm:"index;not null" json:"album_id"`
+	Album   Album `gorm:"foreignKey:AlbumID" json:"-"`
+
+	// One-to-many relation: A user can write multiple comments; nil once the author deleted their account
+	UserID *uint `gorm:"index" json:"user_id"`
+	User   *User `gorm:"foreignKey:UserID" json:"author,omitempty"`
+
+	// Threaded replies
+	ParentID *uint     `gorm:"index" json:"parent_id"`
+	Replies  []Comment `gorm:"-" json:"replies"`
+}
+
+// IsDeleted reports whether the comment was removed by its author or a moderator
+func (c *Comment) IsDeleted() bool {
+	return c.DeletedAt != nil
+}
+
+// CommentRevision keeps a previous body of an edited comment
+type CommentRevision struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Body      string    `gorm:"not null" json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+
+	CommentID uint    `gorm:"index;not null" json:"comment_id"`
+	Comment   Comment `gorm:"foreignKey:CommentID" json:"-"`
+}
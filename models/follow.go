@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Follow records that a user follows another user's activity
+type Follow struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	FollowerID uint `gorm:"uniqueIndex:idx_follow;not null" json:"follower_id"`
+	Follower   User `gorm:"foreignKey:FollowerID" json:"-"`
+	FollowedID uint `gorm:"uniqueIndex:idx_follow;index;not null" json:"followed_id"`
+	Followed   User `gorm:"foreignKey:FollowedID" json:"-"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// UserIdentity links a user to an account at an external OpenID Connect provider
+type UserIdentity struct {
+	gorm.Model
+	Issuer  string `gorm:"uniqueIndex:idx_identity_issuer_subject;not null" json:"issuer"`
+	Subject string `gorm:"uniqueIndex:idx_identity_issuer_subject;not null" json:"subject"`
+	Email   string `json:"email"`
+
+	// One-to-many relation: A user can have multiple identities
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// AlbumFavourite marks an album as a favourite of a user
+type AlbumFavourite struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID  uint  `gorm:"uniqueIndex:idx_album_favourite;not null" json:"user_id"`
+	User    User  `gorm:"foreignKey:UserID" json:"-"`
+	AlbumID uint  `gorm:"uniqueIndex:idx_album_favourite;index;not null" json:"album_id"`
+	Album   Album `gorm:"foreignKey:AlbumID" json:"album,omitempty"`
+}
+
+// SongLike records that a user likes a song
+type SongLike struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID uint `gorm:"uniqueIndex:idx_song_like;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+	SongID uint `gorm:"uniqueIndex:idx_song_like;index;not null" json:"song_id"`
+	Song   Song `gorm:"foreignKey:SongID" json:"song,omitempty"`
+}
+
+// AlbumRating is a user's 1 to 5 rating of an album; each user rates an album once
+type AlbumRating struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Score     int       `gorm:"not null;check:chk_album_ratings_score,score >= 1 AND score <= 5" json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID  uint  `gorm:"uniqueIndex:idx_album_rating;not null" json:"user_id"`
+	User    User  `gorm:"foreignKey:UserID" json:"-"`
+	AlbumID uint  `gorm:"uniqueIndex:idx_album_rating;index;not null" json:"album_id"`
+	Album   Album `gorm:"foreignKey:AlbumID" json:"-"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Roles of an album member, from the least to the most privileged
+const (
+	// RoleViewer can read the album and its songs
+	RoleViewer = "viewer"
+	// RoleEditor can also edit the album details and its songs
+	RoleEditor = "editor"
+	// RoleOwner can also change visibility, share the album and manage members
+	RoleOwner = "owner"
+)
+
+// RoleRank orders roles so permissions can be compared; unknown roles rank 0
+func RoleRank(role string) int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOwner:
+		return 3
+	}
+	return 0
+}
+
+// AlbumMember grants a user a role on an album they did not create
+type AlbumMember struct {
+	gorm.Model
+	Role string `gorm:"not null" json:"role"`
+
+	// Many-to-many relation between albums and users, with a role
+	AlbumID uint  `gorm:"uniqueIndex:idx_album_member;not null" json:"album_id"`
+	Album   Album `gorm:"foreignKey:AlbumID" json:"-"`
+	UserID  uint  `gorm:"uniqueIndex:idx_album_member;not null" json:"user_id"`
+	User    User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// AlbumInvitation invites someone by email to become a member of an album.
+// Only the SHA-256 hash of the invitation token is stored.
+type AlbumInvitation struct {
+	gorm.Model
+	Email      string     `gorm:"index;not null" json:"email"`
+	Role       string     `gorm:"not null" json:"role"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+
+	// One-to-many relation: An album can have multiple invitations
+	AlbumID uint  `gorm:"index;not null" json:"album_id"`
+	Album   Album `gorm:"foreignKey:AlbumID" json:"-"`
+
+	// One-to-many relation: A user can send multiple invitations
+	InvitedByID uint `gorm:"index;not null" json:"invited_by_id"`
+	InvitedBy   User `gorm:"foreignKey:InvitedByID" json:"-"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// Playlist is a user-defined, ordered list of songs taken from any albums
+type Playlist struct {
+	gorm.Model
+	Name        string `gorm:"not null" json:"name"`
+	Description string `json:"description"`
+
+	// One-to-many relation: A user can have multiple playlists
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+
+	// Ordered many-to-many relation with songs through PlaylistEntry
+	Entries []PlaylistEntry `gorm:"foreignKey:PlaylistID" json:"entries,omitempty"`
+}
+
+// PlaylistEntry places a song at a position in a playlist. Positions are
+// contiguous and start at 0; the same song can appear several times.
+type PlaylistEntry struct {
+	ID       uint `gorm:"primaryKey" json:"id"`
+	Position int  `gorm:"index:idx_playlist_position;not null" json:"position"`
+
+	PlaylistID uint `gorm:"index:idx_playlist_position;not null" json:"playlist_id"`
+	SongID     uint `gorm:"index;not null" json:"song_id"`
+	Song       Song `gorm:"foreignKey:SongID" json:"song"`
+}
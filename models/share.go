@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AlbumShare records a share link minted for an album. The link holds a random
+// token stored hashed; deleting the record revokes the link.
+type AlbumShare struct {
+	gorm.Model
+	Label     string     `json:"label"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// One-to-many relation: An album can have multiple shares
+	AlbumID uint  `gorm:"index;not null" json:"album_id"`
+	Album   Album `gorm:"foreignKey:AlbumID" json:"-"`
+
+	// One-to-many relation: A user can create multiple shares
+	CreatedByID uint `gorm:"index;not null" json:"created_by_id"`
+	CreatedBy   User `gorm:"foreignKey:CreatedByID" json:"-"`
+}
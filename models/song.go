@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Song represents a music track in an album
 type Song struct {
 	ID           uint   `gorm:"primaryKey" json:"id"`
@@ -8,6 +10,17 @@ type Song struct {
 	ThumbnailURL string `json:"thumbnail_url"`
 	ViewCount    int64  `json:"view_count"`
 
+	// Only filled in when the YouTube Data API is configured
+	YoutubeLikeCount int64      `json:"youtube_like_count,omitempty"`
+	DurationSeconds  int        `json:"duration_seconds,omitempty"`
+	PublishedAt      *time.Time `json:"published_at,omitempty"`
+
+	// Number of users who like the song, computed when the song is returned
+	LikeCount int64 `gorm:"-" json:"like_count"`
+
+	// Signed URL of the thumbnail served from the server's cache, set in album details
+	CachedThumbnailURL string `gorm:"-" json:"cached_thumbnail_url,omitempty"`
+
 	// One-to-many relation: An album can have multiple songs
 	AlbumID uint  `json:"album_id"`
 	Album   Album `gorm:"foreignKey:AlbumID" json:"album,omitempty"`
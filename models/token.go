@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Purposes a UserToken can be issued for
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
+// UserToken is a single-use, expiring token sent to a user by email.
+// Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	gorm.Model
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	Purpose   string     `gorm:"index;not null" json:"purpose"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+
+	// One-to-many relation: A user can have multiple tokens
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// IsUsable reports whether the token has neither been used nor expired.
+func (t *UserToken) IsUsable() bool {
+	return t.UsedAt == nil && time.Now().Before(t.ExpiresAt)
+}
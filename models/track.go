@@ -0,0 +1,12 @@
+package models
+
+// AlbumTrack is a track of the release an album was enriched from. Unlike songs,
+// tracks have no YouTube video; they describe the original track listing.
+type AlbumTrack struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Position int    `gorm:"not null" json:"position"`
+	Title    string `gorm:"not null" json:"title"`
+	LengthMs int    `json:"length_ms,omitempty"`
+
+	AlbumID uint `gorm:"index;not null" json:"album_id"`
+}
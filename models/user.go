@@ -1,15 +1,29 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	Email    string `gorm:"uniqueIndex;not null" json:"email"`
-	Password string `gorm:"not null" json:"-"`
-	Name     string `json:"name"`
-	
+	Email           string     `gorm:"uniqueIndex;not null" json:"email"`
+	Password        string     `gorm:"not null" json:"-"`
+	Name            string     `json:"name"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// IsAdmin grants moderation rights over the whole site
+	IsAdmin bool `gorm:"not null;default:false" json:"-"`
+
+	// TokenVersion is embedded in issued JWTs; incrementing it revokes every existing token
+	TokenVersion uint `gorm:"not null;default:0" json:"-"`
+
 	// One-to-many relation: A user can have multiple albums
 	Albums []Album `gorm:"foreignKey:UserID" json:"albums,omitempty"`
 }
+
+// IsEmailVerified reports whether the user has confirmed their email address.
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
@@ -0,0 +1,335 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"example/web-service-gin/models"
+
+	"gorm.io/gorm"
+)
+
+// NewGormRepositories returns the repositories backed by the database
+func NewGormRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Albums: &gormAlbums{db: db},
+		Songs:  &gormSongs{db: db},
+		Tags:   &gormTags{db: db},
+		Users:  &gormUsers{db: db},
+	}
+}
+
+// notFound translates the GORM error of a missing record
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type gormAlbums struct {
+	db *gorm.DB
+}
+
+// query starts an album query preloading the requested relations
+func (r *gormAlbums) query(ctx context.Context, with Relations) *gorm.DB {
+	query := r.db.WithContext(ctx)
+	if with&WithOwnerAccount != 0 {
+		query = query.Preload("User")
+	} else if with&WithOwner != 0 {
+		query = query.Preload("User", PublicUser)
+	}
+	if with&WithTags != 0 {
+		query = query.Preload("Tags")
+	}
+	if with&WithSongs != 0 {
+		query = query.Preload("Songs")
+	}
+	if with&WithTracks != 0 {
+		query = query.Preload("Tracks", OrderedTracks)
+	}
+	return query
+}
+
+func (r *gormAlbums) first(query *gorm.DB) (*models.Album, error) {
+	var album models.Album
+	if err := query.First(&album).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &album, nil
+}
+
+func (r *gormAlbums) FindByID(ctx context.Context, id uint, with Relations) (*models.Album, error) {
+	return r.first(r.query(ctx, with).Where("albums.id = ?", id))
+}
+
+func (r *gormAlbums) FindPublic(ctx context.Context, id uint, with Relations) (*models.Album, error) {
+	return r.first(r.query(ctx, with).Where("albums.id = ? AND albums.visibility = ?", id, models.VisibilityPublic))
+}
+
+func (r *gormAlbums) ListByOwner(ctx context.Context, userID uint, with Relations) ([]models.Album, error) {
+	var albums []models.Album
+	err := r.query(ctx, with).Where("albums.user_id = ?", userID).Find(&albums).Error
+	return albums, err
+}
+
+func (r *gormAlbums) ListVisibleTo(ctx context.Context, userID uint, with Relations) ([]models.Album, error) {
+	var albums []models.Album
+	err := VisibleAlbums(r.query(ctx, with), userID).Find(&albums).Error
+	return albums, err
+}
+
+func (r *gormAlbums) ListPublic(ctx context.Context, with Relations) ([]models.Album, error) {
+	var albums []models.Album
+	err := r.query(ctx, with).Where("albums.visibility = ?", models.VisibilityPublic).Find(&albums).Error
+	return albums, err
+}
+
+func (r *gormAlbums) Create(ctx context.Context, album *models.Album) error {
+	return r.db.WithContext(ctx).Create(album).Error
+}
+
+func (r *gormAlbums) Update(ctx context.Context, album *models.Album, changes AlbumChanges) error {
+	columns := changes.columns()
+	if len(columns) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).Model(album).Updates(columns).Error; err != nil {
+		return err
+	}
+	changes.apply(album)
+	return nil
+}
+
+func (r *gormAlbums) SetCoverKey(ctx context.Context, album *models.Album, coverKey string) error {
+	if err := r.db.WithContext(ctx).Model(album).Update("cover_key", coverKey).Error; err != nil {
+		return err
+	}
+	album.CoverKey = coverKey
+	return nil
+}
+
+func (r *gormAlbums) MemberRole(ctx context.Context, albumID, userID uint) (string, error) {
+	var member models.AlbumMember
+	if err := r.db.WithContext(ctx).Where("album_id = ? AND user_id = ?", albumID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return member.Role, nil
+}
+
+func (r *gormAlbums) AttachStats(ctx context.Context, albums ...*models.Album) error {
+	if len(albums) == 0 {
+		return nil
+	}
+
+	albumIDs := make([]uint, 0, len(albums))
+	var songs []*models.Song
+	for _, album := range albums {
+		albumIDs = append(albumIDs, album.ID)
+		for i := range album.Songs {
+			songs = append(songs, &album.Songs[i])
+		}
+	}
+
+	db := r.db.WithContext(ctx)
+	var ratings []struct {
+		AlbumID uint
+		Average float64
+		Count   int64
+	}
+	if err := db.Model(&models.AlbumRating{}).
+		Select("album_id, AVG(score) AS average, COUNT(*) AS count").
+		Where("album_id IN ?", albumIDs).Group("album_id").Scan(&ratings).Error; err != nil {
+		return err
+	}
+
+	var favourites []struct {
+		AlbumID uint
+		Count   int64
+	}
+	if err := db.Model(&models.AlbumFavourite{}).
+		Select("album_id, COUNT(*) AS count").
+		Where("album_id IN ?", albumIDs).Group("album_id").Scan(&favourites).Error; err != nil {
+		return err
+	}
+
+	for _, album := range albums {
+		for _, rating := range ratings {
+			if rating.AlbumID == album.ID {
+				album.AverageRating = math.Round(rating.Average*100) / 100
+				album.RatingCount = rating.Count
+			}
+		}
+		for _, f := range favourites {
+			if f.AlbumID == album.ID {
+				album.FavouriteCount = f.Count
+			}
+		}
+	}
+
+	return (&gormSongs{db: r.db}).AttachStats(ctx, songs...)
+}
+
+type gormSongs struct {
+	db *gorm.DB
+}
+
+func (r *gormSongs) FindByID(ctx context.Context, id uint) (*models.Song, error) {
+	var song models.Song
+	if err := r.db.WithContext(ctx).First(&song, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &song, nil
+}
+
+func (r *gormSongs) FindInAlbum(ctx context.Context, albumID, songID uint) (*models.Song, error) {
+	var song models.Song
+	if err := r.db.WithContext(ctx).Where("id = ? AND album_id = ?", songID, albumID).First(&song).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &song, nil
+}
+
+func (r *gormSongs) ListByAlbum(ctx context.Context, albumID uint) ([]models.Song, error) {
+	var songs []models.Song
+	err := r.db.WithContext(ctx).Where("album_id = ?", albumID).Find(&songs).Error
+	return songs, err
+}
+
+func (r *gormSongs) Create(ctx context.Context, song *models.Song) error {
+	return r.db.WithContext(ctx).Create(song).Error
+}
+
+func (r *gormSongs) Delete(ctx context.Context, song *models.Song) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := RemoveSongsFromPlaylists(tx, []uint{song.ID}); err != nil {
+			return err
+		}
+		if err := tx.Where("song_id = ?", song.ID).Delete(&models.SongLike{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("song_id = ?", song.ID).Delete(&models.Activity{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(song).Error
+	})
+}
+
+func (r *gormSongs) AttachStats(ctx context.Context, songs ...*models.Song) error {
+	if len(songs) == 0 {
+		return nil
+	}
+
+	songIDs := make([]uint, 0, len(songs))
+	for _, song := range songs {
+		songIDs = append(songIDs, song.ID)
+	}
+
+	var likes []struct {
+		SongID uint
+		Count  int64
+	}
+	if err := r.db.WithContext(ctx).Model(&models.SongLike{}).
+		Select("song_id, COUNT(*) AS count").
+		Where("song_id IN ?", songIDs).Group("song_id").Scan(&likes).Error; err != nil {
+		return err
+	}
+
+	counts := make(map[uint]int64, len(likes))
+	for _, l := range likes {
+		counts[l.SongID] = l.Count
+	}
+	for _, song := range songs {
+		song.LikeCount = counts[song.ID]
+	}
+	return nil
+}
+
+type gormTags struct {
+	db *gorm.DB
+}
+
+func (r *gormTags) List(ctx context.Context) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := r.db.WithContext(ctx).Find(&tags).Error
+	return tags, err
+}
+
+func (r *gormTags) FindByName(ctx context.Context, name string) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.db.WithContext(ctx).Where("name = ?", name).First(&tag).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &tag, nil
+}
+
+func (r *gormTags) FindByIDs(ctx context.Context, ids []uint) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&tags).Error
+	return tags, err
+}
+
+func (r *gormTags) Create(ctx context.Context, tag *models.Tag) error {
+	return r.db.WithContext(ctx).Create(tag).Error
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r *gormUsers) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) FindPublic(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := PublicUser(r.db.WithContext(ctx)).Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *gormUsers) UpdateProfile(ctx context.Context, user *models.User, changes ProfileChanges) error {
+	columns := changes.columns()
+	if len(columns) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).Model(user).Updates(columns).Error; err != nil {
+		return err
+	}
+	changes.apply(user)
+	return nil
+}
+
+func (r *gormUsers) SetPassword(ctx context.Context, user *models.User, passwordHash string) error {
+	tokenVersion := user.TokenVersion + 1
+	if err := r.db.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"password":      passwordHash,
+		"token_version": tokenVersion,
+	}).Error; err != nil {
+		return err
+	}
+	user.Password = passwordHash
+	user.TokenVersion = tokenVersion
+	return nil
+}
@@ -0,0 +1,477 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"example/web-service-gin/models"
+
+	"gorm.io/gorm"
+)
+
+// Memory keeps albums, songs, tags and users in maps, for unit tests that do not
+// need a database. Ratings, favourites and likes are not stored, so the
+// statistics it attaches are always zero, and albums have no track listing.
+type Memory struct {
+	mu sync.Mutex
+
+	albums    map[uint]models.Album
+	albumTags map[uint][]uint
+	members   map[[2]uint]string
+	songs     map[uint]models.Song
+	tags      map[uint]models.Tag
+	users     map[uint]models.User
+
+	// Last IDs given out, per table like database sequences
+	lastAlbumID, lastSongID, lastTagID, lastUserID uint
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		albums:    map[uint]models.Album{},
+		albumTags: map[uint][]uint{},
+		members:   map[[2]uint]string{},
+		songs:     map[uint]models.Song{},
+		tags:      map[uint]models.Tag{},
+		users:     map[uint]models.User{},
+	}
+}
+
+// Repositories returns the repositories backed by the store
+func (m *Memory) Repositories() Repositories {
+	return Repositories{
+		Albums: memoryAlbums{m},
+		Songs:  memorySongs{m},
+		Tags:   memoryTags{m},
+		Users:  memoryUsers{m},
+	}
+}
+
+// AddMember gives a user a role on an album, as accepting an invitation does
+func (m *Memory) AddMember(albumID, userID uint, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.members[[2]uint{albumID, userID}] = role
+}
+
+// AddUser stores a user named name with the email name@example.com. It panics if
+// the email is taken, since fixtures are set up by tests.
+func (m *Memory) AddUser(name string) *models.User {
+	user := fixtureUser(name)
+	if err := (memoryUsers{m}).Create(context.Background(), user); err != nil {
+		panic(err)
+	}
+	return user
+}
+
+// AddAlbum stores an album of owner. It panics if a tag does not exist, since
+// fixtures are set up by tests.
+func (m *Memory) AddAlbum(owner *models.User, title, visibility string, tags ...models.Tag) *models.Album {
+	album := fixtureAlbum(owner, title, visibility, tags)
+	if err := (memoryAlbums{m}).Create(context.Background(), album); err != nil {
+		panic(err)
+	}
+	return album
+}
+
+// fixtureUser and fixtureAlbum are the records added by AddUser and AddAlbum
+func fixtureUser(name string) *models.User {
+	return &models.User{Email: name + "@example.com", Password: "hash", Name: name}
+}
+
+func fixtureAlbum(owner *models.User, title, visibility string, tags []models.Tag) *models.Album {
+	return &models.Album{Title: title, Artist: "Artist", Visibility: visibility, UserID: &owner.ID, Tags: tags}
+}
+
+// publicUser copies the fields of a user that anyone may see
+func publicUser(user models.User) models.User {
+	return models.User{
+		Model: gorm.Model{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt},
+		Name:  user.Name,
+	}
+}
+
+// loadAlbum copies a stored album with the requested relations. The caller holds the lock.
+func (m *Memory) loadAlbum(stored models.Album, with Relations) models.Album {
+	album := stored
+
+	if album.UserID != nil && with&(WithOwner|WithOwnerAccount) != 0 {
+		owner := m.users[*album.UserID]
+		if with&WithOwnerAccount == 0 {
+			owner = publicUser(owner)
+		}
+		album.User = owner
+	}
+	if with&WithTags != 0 {
+		for _, id := range m.albumTags[album.ID] {
+			album.Tags = append(album.Tags, m.tags[id])
+		}
+		sort.Slice(album.Tags, func(i, j int) bool { return album.Tags[i].ID < album.Tags[j].ID })
+	}
+	if with&WithSongs != 0 {
+		album.Songs = m.albumSongs(album.ID)
+	}
+
+	album.AfterFind(nil)
+	return album
+}
+
+// albumSongs returns the songs of an album in creation order. The caller holds the lock.
+func (m *Memory) albumSongs(albumID uint) []models.Song {
+	songs := []models.Song{}
+	for _, song := range m.songs {
+		if song.AlbumID == albumID {
+			songs = append(songs, song)
+		}
+	}
+	sort.Slice(songs, func(i, j int) bool { return songs[i].ID < songs[j].ID })
+	return songs
+}
+
+// listAlbums returns the albums matching keep in creation order
+func (m *Memory) listAlbums(with Relations, keep func(models.Album) bool) []models.Album {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	albums := []models.Album{}
+	for _, album := range m.albums {
+		if keep(album) {
+			albums = append(albums, m.loadAlbum(album, with))
+		}
+	}
+	sort.Slice(albums, func(i, j int) bool { return albums[i].ID < albums[j].ID })
+	return albums
+}
+
+// findAlbum returns the album with the given ID when it matches keep
+func (m *Memory) findAlbum(id uint, with Relations, keep func(models.Album) bool) (*models.Album, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.albums[id]
+	if !ok || !keep(stored) {
+		return nil, ErrNotFound
+	}
+	album := m.loadAlbum(stored, with)
+	return &album, nil
+}
+
+type memoryAlbums struct {
+	m *Memory
+}
+
+func (r memoryAlbums) FindByID(ctx context.Context, id uint, with Relations) (*models.Album, error) {
+	return r.m.findAlbum(id, with, func(models.Album) bool { return true })
+}
+
+func (r memoryAlbums) FindPublic(ctx context.Context, id uint, with Relations) (*models.Album, error) {
+	return r.m.findAlbum(id, with, func(album models.Album) bool {
+		return album.Visibility == models.VisibilityPublic
+	})
+}
+
+func (r memoryAlbums) ListByOwner(ctx context.Context, userID uint, with Relations) ([]models.Album, error) {
+	return r.m.listAlbums(with, func(album models.Album) bool {
+		return album.UserID != nil && *album.UserID == userID
+	}), nil
+}
+
+func (r memoryAlbums) ListVisibleTo(ctx context.Context, userID uint, with Relations) ([]models.Album, error) {
+	return r.m.listAlbums(with, func(album models.Album) bool {
+		_, member := r.m.members[[2]uint{album.ID, userID}]
+		return (album.UserID != nil && *album.UserID == userID) || album.Visibility == models.VisibilityPublic || member
+	}), nil
+}
+
+func (r memoryAlbums) ListPublic(ctx context.Context, with Relations) ([]models.Album, error) {
+	return r.m.listAlbums(with, func(album models.Album) bool {
+		return album.Visibility == models.VisibilityPublic
+	}), nil
+}
+
+func (r memoryAlbums) Create(ctx context.Context, album *models.Album) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if album.Visibility == "" {
+		album.Visibility = models.VisibilityPrivate
+	}
+	r.m.lastAlbumID++
+	album.ID = r.m.lastAlbumID
+
+	var tagIDs []uint
+	for _, tag := range album.Tags {
+		if _, ok := r.m.tags[tag.ID]; !ok {
+			return fmt.Errorf("tag %d does not exist", tag.ID)
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+
+	stored := *album
+	stored.User, stored.Tags, stored.Songs, stored.Tracks = models.User{}, nil, nil, nil
+	r.m.albums[album.ID] = stored
+	r.m.albumTags[album.ID] = tagIDs
+	return nil
+}
+
+func (r memoryAlbums) Update(ctx context.Context, album *models.Album, changes AlbumChanges) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	stored, ok := r.m.albums[album.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	changes.apply(&stored)
+	r.m.albums[album.ID] = stored
+	changes.apply(album)
+	return nil
+}
+
+func (r memoryAlbums) SetCoverKey(ctx context.Context, album *models.Album, coverKey string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	stored, ok := r.m.albums[album.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.CoverKey = coverKey
+	r.m.albums[album.ID] = stored
+	album.CoverKey = coverKey
+	return nil
+}
+
+func (r memoryAlbums) MemberRole(ctx context.Context, albumID, userID uint) (string, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.members[[2]uint{albumID, userID}], nil
+}
+
+func (r memoryAlbums) AttachStats(ctx context.Context, albums ...*models.Album) error {
+	for _, album := range albums {
+		album.AverageRating, album.RatingCount, album.FavouriteCount = 0, 0, 0
+		for i := range album.Songs {
+			album.Songs[i].LikeCount = 0
+		}
+	}
+	return nil
+}
+
+type memorySongs struct {
+	m *Memory
+}
+
+func (r memorySongs) FindByID(ctx context.Context, id uint) (*models.Song, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	song, ok := r.m.songs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &song, nil
+}
+
+func (r memorySongs) FindInAlbum(ctx context.Context, albumID, songID uint) (*models.Song, error) {
+	song, err := r.FindByID(ctx, songID)
+	if err != nil || song.AlbumID != albumID {
+		return nil, ErrNotFound
+	}
+	return song, nil
+}
+
+func (r memorySongs) ListByAlbum(ctx context.Context, albumID uint) ([]models.Song, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.albumSongs(albumID), nil
+}
+
+func (r memorySongs) Create(ctx context.Context, song *models.Song) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.albums[song.AlbumID]; !ok {
+		return fmt.Errorf("album %d does not exist", song.AlbumID)
+	}
+	r.m.lastSongID++
+	song.ID = r.m.lastSongID
+
+	stored := *song
+	stored.Album = models.Album{}
+	r.m.songs[song.ID] = stored
+	return nil
+}
+
+func (r memorySongs) Delete(ctx context.Context, song *models.Song) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.songs, song.ID)
+	return nil
+}
+
+func (r memorySongs) AttachStats(ctx context.Context, songs ...*models.Song) error {
+	for _, song := range songs {
+		song.LikeCount = 0
+	}
+	return nil
+}
+
+type memoryTags struct {
+	m *Memory
+}
+
+// listTags returns the tags matching keep in creation order
+func (r memoryTags) listTags(keep func(models.Tag) bool) []models.Tag {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	tags := []models.Tag{}
+	for _, tag := range r.m.tags {
+		if keep(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	return tags
+}
+
+func (r memoryTags) List(ctx context.Context) ([]models.Tag, error) {
+	return r.listTags(func(models.Tag) bool { return true }), nil
+}
+
+func (r memoryTags) FindByName(ctx context.Context, name string) (*models.Tag, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, tag := range r.m.tags {
+		if tag.Name == name {
+			return &tag, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r memoryTags) FindByIDs(ctx context.Context, ids []uint) ([]models.Tag, error) {
+	wanted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	return r.listTags(func(tag models.Tag) bool { return wanted[tag.ID] }), nil
+}
+
+func (r memoryTags) Create(ctx context.Context, tag *models.Tag) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, other := range r.m.tags {
+		if other.Name == tag.Name {
+			return fmt.Errorf("tag %q already exists", tag.Name)
+		}
+	}
+	r.m.lastTagID++
+	now := time.Now()
+	tag.ID, tag.CreatedAt, tag.UpdatedAt = r.m.lastTagID, now, now
+
+	stored := *tag
+	stored.Albums = nil
+	r.m.tags[tag.ID] = stored
+	return nil
+}
+
+type memoryUsers struct {
+	m *Memory
+}
+
+// findUser returns a copy of the user matching keep
+func (r memoryUsers) findUser(keep func(models.User) bool) (*models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, user := range r.m.users {
+		if keep(user) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// emailInUse reports whether another account uses the address. The caller holds the lock.
+func (r memoryUsers) emailInUse(email string, userID uint) bool {
+	for id, user := range r.m.users {
+		if id != userID && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (r memoryUsers) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.findUser(func(user models.User) bool { return user.ID == id })
+}
+
+func (r memoryUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findUser(func(user models.User) bool { return user.Email == email })
+}
+
+func (r memoryUsers) FindPublic(ctx context.Context, id uint) (*models.User, error) {
+	user, err := r.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	public := publicUser(*user)
+	return &public, nil
+}
+
+func (r memoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if r.emailInUse(user.Email, 0) {
+		return fmt.Errorf("email %q already in use", user.Email)
+	}
+	r.m.lastUserID++
+	now := time.Now()
+	user.ID, user.CreatedAt, user.UpdatedAt = r.m.lastUserID, now, now
+
+	stored := *user
+	stored.Albums = nil
+	r.m.users[user.ID] = stored
+	return nil
+}
+
+func (r memoryUsers) UpdateProfile(ctx context.Context, user *models.User, changes ProfileChanges) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	stored, ok := r.m.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if changes.Email != nil && r.emailInUse(*changes.Email, user.ID) {
+		return fmt.Errorf("email %q already in use", *changes.Email)
+	}
+	changes.apply(&stored)
+	r.m.users[user.ID] = stored
+	changes.apply(user)
+	return nil
+}
+
+func (r memoryUsers) SetPassword(ctx context.Context, user *models.User, passwordHash string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	stored, ok := r.m.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Password = passwordHash
+	stored.TokenVersion = user.TokenVersion + 1
+	r.m.users[user.ID] = stored
+	user.Password, user.TokenVersion = stored.Password, stored.TokenVersion
+	return nil
+}
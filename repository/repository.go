@@ -0,0 +1,180 @@
+// Package repository holds the data access of albums, songs, tags and users behind
+// interfaces. The server uses the GORM implementation; unit tests use the in-memory one.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"example/web-service-gin/models"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// Relations selects the associations loaded with an album
+type Relations uint
+
+// WithoutRelations loads the album alone
+const WithoutRelations Relations = 0
+
+const (
+	// WithOwner loads the fields of the album's creator that anyone may see
+	WithOwner Relations = 1 << iota
+	// WithOwnerAccount loads every field of the album's creator, for their own views
+	WithOwnerAccount
+	// WithTags loads the album's tags
+	WithTags
+	// WithSongs loads the album's songs
+	WithSongs
+	// WithTracks loads the track listing of the release, in order
+	WithTracks
+)
+
+// AlbumChanges lists the album fields to update; nil fields are left unchanged
+type AlbumChanges struct {
+	Title      *string
+	Artist     *string
+	Price      *float64
+	Visibility *string
+}
+
+func (c AlbumChanges) columns() map[string]interface{} {
+	columns := map[string]interface{}{}
+	if c.Title != nil {
+		columns["title"] = *c.Title
+	}
+	if c.Artist != nil {
+		columns["artist"] = *c.Artist
+	}
+	if c.Price != nil {
+		columns["price"] = *c.Price
+	}
+	if c.Visibility != nil {
+		columns["visibility"] = *c.Visibility
+	}
+	return columns
+}
+
+func (c AlbumChanges) apply(album *models.Album) {
+	if c.Title != nil {
+		album.Title = *c.Title
+	}
+	if c.Artist != nil {
+		album.Artist = *c.Artist
+	}
+	if c.Price != nil {
+		album.Price = *c.Price
+	}
+	if c.Visibility != nil {
+		album.Visibility = *c.Visibility
+	}
+}
+
+// ProfileChanges lists the profile fields to update; nil fields are left unchanged.
+// A new email address has to be verified again.
+type ProfileChanges struct {
+	Name  *string
+	Email *string
+}
+
+func (c ProfileChanges) columns() map[string]interface{} {
+	columns := map[string]interface{}{}
+	if c.Name != nil {
+		columns["name"] = *c.Name
+	}
+	if c.Email != nil {
+		columns["email"] = *c.Email
+		columns["email_verified_at"] = nil
+	}
+	return columns
+}
+
+func (c ProfileChanges) apply(user *models.User) {
+	if c.Name != nil {
+		user.Name = *c.Name
+	}
+	if c.Email != nil {
+		user.Email = *c.Email
+		user.EmailVerifiedAt = nil
+	}
+}
+
+// AlbumRepository stores albums and the roles of their members
+type AlbumRepository interface {
+	// FindByID returns an album whatever its visibility
+	FindByID(ctx context.Context, id uint, with Relations) (*models.Album, error)
+	// FindPublic returns an album only when it is public
+	FindPublic(ctx context.Context, id uint, with Relations) (*models.Album, error)
+	// ListByOwner returns the albums created by a user
+	ListByOwner(ctx context.Context, userID uint, with Relations) ([]models.Album, error)
+	// ListVisibleTo returns the albums a user may read: their own albums,
+	// albums they are a member of and public albums
+	ListVisibleTo(ctx context.Context, userID uint, with Relations) ([]models.Album, error)
+	// ListPublic returns the public albums
+	ListPublic(ctx context.Context, with Relations) ([]models.Album, error)
+	// Create stores a new album together with its tags
+	Create(ctx context.Context, album *models.Album) error
+	// Update saves the changed fields and applies them to album
+	Update(ctx context.Context, album *models.Album, changes AlbumChanges) error
+	// SetCoverKey sets the storage key of the album's uploaded cover, or removes it when empty
+	SetCoverKey(ctx context.Context, album *models.Album, coverKey string) error
+	// MemberRole returns the role of a member of the album, or an empty string for non-members
+	MemberRole(ctx context.Context, albumID, userID uint) (string, error)
+	// AttachStats fills the rating and favourite statistics of the albums
+	// and the like counts of their loaded songs
+	AttachStats(ctx context.Context, albums ...*models.Album) error
+}
+
+// SongRepository stores the songs of albums
+type SongRepository interface {
+	// FindByID returns a song whatever its album
+	FindByID(ctx context.Context, id uint) (*models.Song, error)
+	// FindInAlbum returns a song of an album
+	FindInAlbum(ctx context.Context, albumID, songID uint) (*models.Song, error)
+	// ListByAlbum returns the songs of an album
+	ListByAlbum(ctx context.Context, albumID uint) ([]models.Song, error)
+	// Create stores a new song
+	Create(ctx context.Context, song *models.Song) error
+	// Delete removes a song with its likes, activities and playlist entries
+	Delete(ctx context.Context, song *models.Song) error
+	// AttachStats fills the like counts of the songs
+	AttachStats(ctx context.Context, songs ...*models.Song) error
+}
+
+// TagRepository stores the tags albums are filed under
+type TagRepository interface {
+	// List returns every tag
+	List(ctx context.Context) ([]models.Tag, error)
+	// FindByName returns the tag with the given name
+	FindByName(ctx context.Context, name string) (*models.Tag, error)
+	// FindByIDs returns the existing tags among ids
+	FindByIDs(ctx context.Context, ids []uint) ([]models.Tag, error)
+	// Create stores a new tag
+	Create(ctx context.Context, tag *models.Tag) error
+}
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	// FindByID returns a user account
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	// FindByEmail returns the account registered with an email address
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindPublic returns the fields of a user that anyone may see
+	FindPublic(ctx context.Context, id uint) (*models.User, error)
+	// Create stores a new account
+	Create(ctx context.Context, user *models.User) error
+	// UpdateProfile saves the changed fields and applies them to user
+	UpdateProfile(ctx context.Context, user *models.User, changes ProfileChanges) error
+	// SetPassword saves a new password hash and increments the token version,
+	// which revokes every token issued before
+	SetPassword(ctx context.Context, user *models.User, passwordHash string) error
+}
+
+// Repositories groups the repositories used by the handlers
+type Repositories struct {
+	Albums AlbumRepository
+	Songs  SongRepository
+	Tags   TagRepository
+	Users  UserRepository
+}
@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"example/web-service-gin/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var databaseCount atomic.Int64
+
+// store is an implementation of the repositories under test, with the
+// functions adding fixtures to it
+type store struct {
+	Repositories
+	addUser   func(name string) *models.User
+	addAlbum  func(owner *models.User, title, visibility string, tags ...models.Tag) *models.Album
+	addMember func(albumID, userID uint, role string)
+}
+
+// forEachStore runs a test against the GORM repositories on an empty SQLite
+// database and against the in-memory ones, which must behave the same
+func forEachStore(t *testing.T, test func(t *testing.T, s store)) {
+	t.Run("gorm", func(t *testing.T) {
+		dsn := fmt.Sprintf("file:repository%d?mode=memory&cache=shared", databaseCount.Add(1))
+		db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sqlDB.Close() })
+		if err := db.AutoMigrate(
+			&models.Album{}, &models.User{}, &models.Tag{}, &models.Song{}, &models.AlbumTrack{},
+			&models.AlbumMember{}, &models.AlbumFavourite{}, &models.AlbumRating{}, &models.SongLike{},
+			&models.Activity{}, &models.Playlist{}, &models.PlaylistEntry{},
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		repositories := NewGormRepositories(db)
+		test(t, store{
+			Repositories: repositories,
+			addUser: func(name string) *models.User {
+				user := fixtureUser(name)
+				if err := repositories.Users.Create(context.Background(), user); err != nil {
+					t.Fatal(err)
+				}
+				return user
+			},
+			addAlbum: func(owner *models.User, title, visibility string, tags ...models.Tag) *models.Album {
+				album := fixtureAlbum(owner, title, visibility, tags)
+				if err := repositories.Albums.Create(context.Background(), album); err != nil {
+					t.Fatal(err)
+				}
+				return album
+			},
+			addMember: func(albumID, userID uint, role string) {
+				if err := db.Create(&models.AlbumMember{AlbumID: albumID, UserID: userID, Role: role}).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+		})
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		memory := NewMemory()
+		test(t, store{
+			Repositories: memory.Repositories(),
+			addUser:      memory.AddUser,
+			addAlbum:     memory.AddAlbum,
+			addMember:    memory.AddMember,
+		})
+	})
+}
+
+func titles(albums []models.Album) []string {
+	titles := make([]string, len(albums))
+	for i, album := range albums {
+		titles[i] = album.Title
+	}
+	return titles
+}
+
+func TestAlbumVisibility(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store) {
+		ctx := context.Background()
+		alice, bob, carol := s.addUser("alice"), s.addUser("bob"), s.addUser("carol")
+		private := s.addAlbum(alice, "Private", models.VisibilityPrivate)
+		s.addAlbum(alice, "Unlisted", models.VisibilityUnlisted)
+		public := s.addAlbum(alice, "Public", models.VisibilityPublic)
+		s.addAlbum(bob, "Bob's", models.VisibilityPrivate)
+		s.addMember(private.ID, bob.ID, models.RoleEditor)
+
+		tests := []struct {
+			name string
+			list func() ([]models.Album, error)
+			want string
+		}{
+			{"owned by alice", func() ([]models.Album, error) { return s.Albums.ListByOwner(ctx, alice.ID, WithoutRelations) }, "[Private Unlisted Public]"},
+			{"visible to bob", func() ([]models.Album, error) { return s.Albums.ListVisibleTo(ctx, bob.ID, WithoutRelations) }, "[Private Public Bob's]"},
+			{"visible to carol", func() ([]models.Album, error) { return s.Albums.ListVisibleTo(ctx, carol.ID, WithoutRelations) }, "[Public]"},
+			{"public", func() ([]models.Album, error) { return s.Albums.ListPublic(ctx, WithoutRelations) }, "[Public]"},
+		}
+		for _, tt := range tests {
+			albums, err := tt.list()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(titles(albums)); got != tt.want {
+				t.Errorf("albums %s = %s, want %s", tt.name, got, tt.want)
+			}
+		}
+
+		if _, err := s.Albums.FindPublic(ctx, private.ID, WithoutRelations); err != ErrNotFound {
+			t.Errorf("FindPublic of a private album: %v, want ErrNotFound", err)
+		}
+		if album, err := s.Albums.FindPublic(ctx, public.ID, WithoutRelations); err != nil || album.Title != "Public" {
+			t.Errorf("FindPublic = %v, %v", album, err)
+		}
+		if _, err := s.Albums.FindByID(ctx, 9999, WithoutRelations); err != ErrNotFound {
+			t.Errorf("FindByID of a missing album: %v, want ErrNotFound", err)
+		}
+
+		if role, err := s.Albums.MemberRole(ctx, private.ID, bob.ID); err != nil || role != models.RoleEditor {
+			t.Errorf("bob's role = %q, %v", role, err)
+		}
+		if role, err := s.Albums.MemberRole(ctx, private.ID, carol.ID); err != nil || role != "" {
+			t.Errorf("carol's role = %q, %v", role, err)
+		}
+	})
+}
+
+func TestAlbumRelations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store) {
+		ctx := context.Background()
+		alice := s.addUser("alice")
+		jazz := &models.Tag{Name: "jazz"}
+		if err := s.Tags.Create(ctx, jazz); err != nil {
+			t.Fatal(err)
+		}
+		album := s.addAlbum(alice, "Album", models.VisibilityPublic, *jazz)
+		for _, title := range []string{"First", "Second"} {
+			if err := s.Songs.Create(ctx, &models.Song{Title: title, AlbumID: album.ID}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		bare, err := s.Albums.FindByID(ctx, album.ID, WithoutRelations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bare.User.ID != 0 || len(bare.Tags) != 0 || len(bare.Songs) != 0 {
+			t.Errorf("relations loaded without being asked: %+v", bare)
+		}
+
+		public, err := s.Albums.FindByID(ctx, album.ID, WithOwner|WithTags|WithSongs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if public.User.Name != "alice" || public.User.Email != "" {
+			t.Errorf("public owner %+v, want the name without the email", public.User)
+		}
+		if len(public.Tags) != 1 || public.Tags[0].Name != "jazz" {
+			t.Errorf("tags %+v", public.Tags)
+		}
+		if len(public.Songs) != 2 || public.Songs[0].Title != "First" {
+			t.Errorf("songs %+v", public.Songs)
+		}
+
+		account, err := s.Albums.FindByID(ctx, album.ID, WithOwnerAccount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if account.User.Email != alice.Email {
+			t.Errorf("owner account %+v, want the email", account.User)
+		}
+
+		if err := s.Albums.AttachStats(ctx, public); err != nil {
+			t.Fatal(err)
+		}
+		if public.RatingCount != 0 || public.FavouriteCount != 0 || public.Songs[0].LikeCount != 0 {
+			t.Errorf("statistics of an album nobody rated %+v", public)
+		}
+	})
+}
+
+func TestAlbumChanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store) {
+		ctx := context.Background()
+		alice := s.addUser("alice")
+		album := s.addAlbum(alice, "Draft", models.VisibilityPrivate)
+
+		title, visibility := "Final", models.VisibilityUnlisted
+		if err := s.Albums.Update(ctx, album, AlbumChanges{Title: &title, Visibility: &visibility}); err != nil {
+			t.Fatal(err)
+		}
+		if album.Title != title || album.Artist != "Artist" {
+			t.Errorf("changes not applied to the album: %+v", album)
+		}
+
+		if err := s.Albums.SetCoverKey(ctx, album, "covers/1/abc/original.png"); err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := s.Albums.FindByID(ctx, album.ID, WithoutRelations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Title != title || stored.Visibility != visibility {
+			t.Errorf("stored album %+v", stored)
+		}
+		if stored.CoverImages["original"] != "/media/covers/1/abc/original.png" {
+			t.Errorf("cover images %v", stored.CoverImages)
+		}
+	})
+}
+
+func TestSongs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store) {
+		ctx := context.Background()
+		alice := s.addUser("alice")
+		first := s.addAlbum(alice, "First", models.VisibilityPrivate)
+		second := s.addAlbum(alice, "Second", models.VisibilityPrivate)
+
+		song := &models.Song{Title: "Song", YoutubeURL: "https://youtu.be/dQw4w9WgXcQ", AlbumID: first.ID}
+		if err := s.Songs.Create(ctx, song); err != nil {
+			t.Fatal(err)
+		}
+
+		if found, err := s.Songs.FindInAlbum(ctx, first.ID, song.ID); err != nil || found.Title != "Song" {
+			t.Errorf("FindInAlbum = %v, %v", found, err)
+		}
+		if _, err := s.Songs.FindInAlbum(ctx, second.ID, song.ID); err != ErrNotFound {
+			t.Errorf("FindInAlbum of another album: %v, want ErrNotFound", err)
+		}
+		if songs, err := s.Songs.ListByAlbum(ctx, second.ID); err != nil || len(songs) != 0 {
+			t.Errorf("songs of the empty album %v, %v", songs, err)
+		}
+
+		if err := s.Songs.Delete(ctx, song); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Songs.FindByID(ctx, song.ID); err != ErrNotFound {
+			t.Errorf("FindByID of a deleted song: %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store) {
+		ctx := context.Background()
+		var ids []uint
+		for _, name := range []string{"jazz", "rock", "pop"} {
+			tag := &models.Tag{Name: name}
+			if err := s.Tags.Create(ctx, tag); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, tag.ID)
+		}
+
+		if err := s.Tags.Create(ctx, &models.Tag{Name: "jazz"}); err == nil {
+			t.Error("created a second tag with the same name")
+		}
+		if tag, err := s.Tags.FindByName(ctx, "rock"); err != nil || tag.ID != ids[1] {
+			t.Errorf("FindByName = %v, %v", tag, err)
+		}
+		if _, err := s.Tags.FindByName(ctx, "blues"); err != ErrNotFound {
+			t.Errorf("FindByName of a missing tag: %v, want ErrNotFound", err)
+		}
+		if tags, err := s.Tags.FindByIDs(ctx, []uint{ids[2], 9999}); err != nil || len(tags) != 1 || tags[0].Name != "pop" {
+			t.Errorf("FindByIDs = %v, %v", tags, err)
+		}
+		if tags, err := s.Tags.List(ctx); err != nil || len(tags) != 3 {
+			t.Errorf("List = %v, %v", tags, err)
+		}
+	})
+}
+
+func TestUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store) {
+		ctx := context.Background()
+		alice := s.addUser("alice")
+		s.addUser("bob")
+
+		if err := s.Users.Create(ctx, &models.User{Email: alice.Email, Password: "hash"}); err == nil {
+			t.Error("registered the same email twice")
+		}
+		if user, err := s.Users.FindByEmail(ctx, alice.Email); err != nil || user.ID != alice.ID {
+			t.Errorf("FindByEmail = %v, %v", user, err)
+		}
+		if _, err := s.Users.FindByEmail(ctx, "nobody@example.com"); err != ErrNotFound {
+			t.Errorf("FindByEmail of a missing user: %v, want ErrNotFound", err)
+		}
+		if user, err := s.Users.FindPublic(ctx, alice.ID); err != nil || user.Name != "alice" || user.Email != "" || user.Password != "" {
+			t.Errorf("FindPublic = %+v, %v", user, err)
+		}
+
+		name, email := "Alice", "alice@example.org"
+		if err := s.Users.UpdateProfile(ctx, alice, ProfileChanges{Name: &name, Email: &email}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Users.SetPassword(ctx, alice, "new-hash"); err != nil {
+			t.Fatal(err)
+		}
+		if alice.TokenVersion != 1 {
+			t.Errorf("token version %d after a password change, want 1", alice.TokenVersion)
+		}
+
+		stored, err := s.Users.FindByID(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Name != name || stored.Email != email || stored.IsEmailVerified() || stored.Password != "new-hash" || stored.TokenVersion != 1 {
+			t.Errorf("stored user %+v", stored)
+		}
+	})
+}
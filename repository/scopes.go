@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"example/web-service-gin/models"
+
+	"gorm.io/gorm"
+)
+
+// PublicUser limits loaded users to fields that can be shown to anyone
+func PublicUser(db *gorm.DB) *gorm.DB {
+	return db.Select("id", "name", "created_at", "updated_at")
+}
+
+// OrderedTracks loads an album's track listing in order
+func OrderedTracks(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// VisibleAlbums restricts a query to the albums a user may read:
+// their own albums, albums they are a member of and public albums
+func VisibleAlbums(db *gorm.DB, userID uint) *gorm.DB {
+	memberOf := db.Session(&gorm.Session{NewDB: true}).Model(&models.AlbumMember{}).Select("album_id").Where("user_id = ?", userID)
+	return db.Where("albums.user_id = ? OR albums.visibility = ? OR albums.id IN (?)", userID, models.VisibilityPublic, memberOf)
+}
+
+// CompactPlaylist renumbers the entries of a playlist from 0 in their current order
+func CompactPlaylist(tx *gorm.DB, playlistID uint) error {
+	var ids []uint
+	if err := tx.Model(&models.PlaylistEntry{}).Where("playlist_id = ?", playlistID).Order("position, id").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if err := tx.Model(&models.PlaylistEntry{}).Where("id = ?", id).Update("position", i).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveSongsFromPlaylists deletes every playlist entry referencing the songs
+// and closes the gaps left in the affected playlists
+func RemoveSongsFromPlaylists(tx *gorm.DB, songIDs []uint) error {
+	if len(songIDs) == 0 {
+		return nil
+	}
+
+	var playlistIDs []uint
+	if err := tx.Model(&models.PlaylistEntry{}).Distinct("playlist_id").Where("song_id IN ?", songIDs).Pluck("playlist_id", &playlistIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("song_id IN ?", songIDs).Delete(&models.PlaylistEntry{}).Error; err != nil {
+		return err
+	}
+	for _, playlistID := range playlistIDs {
+		if err := CompactPlaylist(tx, playlistID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache stores values under string keys for a limited time
+type Cache interface {
+	// Get returns the value of key and whether it was found and not expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// LRUCache is an in-memory Cache holding at most Capacity entries;
+// the least recently used entry is dropped to make room for a new one
+type LRUCache struct {
+	capacity int
+	mu       sync.Mutex
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRUCache returns an empty in-memory cache
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+// Get returns a copy of the cached value and marks the entry as recently used
+func (l *LRUCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		l.order.Remove(element)
+		delete(l.entries, key)
+		return nil, false, nil
+	}
+	l.order.MoveToFront(element)
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+// Set stores a value, evicting the least recently used entry when the cache is full
+func (l *LRUCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := &lruEntry{key: key, value: append([]byte(nil), value...), expiresAt: time.Now().Add(ttl)}
+	if element, ok := l.entries[key]; ok {
+		element.Value = entry
+		l.order.MoveToFront(element)
+		return nil
+	}
+
+	l.entries[key] = l.order.PushFront(entry)
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// CacheStats counts the lookups of a cache since the server started
+type CacheStats struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Errors   int64   `json:"errors"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// VideoInfoCache puts a Cache in front of a YouTube metadata lookup, keyed by video ID.
+// Cache failures are logged and counted, and the lookup then goes to YouTube.
+type VideoInfoCache struct {
+	Cache Cache
+	TTL   time.Duration
+	// Fetch looks up a video on a cache miss
+	Fetch func(ctx context.Context, videoID string) (*VideoInfo, error)
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+}
+
+// GetVideoInfo returns the information of a video, from the cache when possible
+func (v *VideoInfoCache) GetVideoInfo(ctx context.Context, videoID string) (*VideoInfo, error) {
+	key := "youtube:video:" + videoID
+
+	data, found, err := v.Cache.Get(ctx, key)
+	if err != nil {
+		v.errors.Add(1)
+		slog.WarnContext(ctx, "Video info cache lookup failed", "video_id", videoID, "error", err)
+	}
+	if found {
+		var info VideoInfo
+		if err := json.Unmarshal(data, &info); err == nil {
+			v.hits.Add(1)
+			return &info, nil
+		}
+	}
+	v.misses.Add(1)
+
+	info, err := v.Fetch(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(info); err == nil {
+		if err := v.Cache.Set(ctx, key, data, v.TTL); err != nil {
+			v.errors.Add(1)
+			slog.WarnContext(ctx, "Video info cache update failed", "video_id", videoID, "error", err)
+		}
+	}
+	return info, nil
+}
+
+// GetVideoInfoFromURL extracts the video ID of a YouTube URL and returns its information
+func (v *VideoInfoCache) GetVideoInfoFromURL(ctx context.Context, url string) (*VideoInfo, error) {
+	videoID, err := ExtractVideoID(url)
+	if err != nil {
+		return nil, err
+	}
+	return v.GetVideoInfo(ctx, videoID)
+}
+
+// Stats returns the hit and miss counters of the cache
+func (v *VideoInfoCache) Stats() CacheStats {
+	stats := CacheStats{Hits: v.hits.Load(), Misses: v.misses.Load(), Errors: v.errors.Load()}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
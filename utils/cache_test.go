@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	cache := NewLRUCache(2)
+	ctx := context.Background()
+
+	cache.Set(ctx, "a", []byte("1"), time.Hour)
+	cache.Set(ctx, "b", []byte("2"), time.Hour)
+	// Reading a makes b the least recently used entry
+	if value, found, _ := cache.Get(ctx, "a"); !found || string(value) != "1" {
+		t.Fatalf("Get(a) = %q, %v", value, found)
+	}
+	cache.Set(ctx, "c", []byte("3"), time.Hour)
+
+	if _, found, _ := cache.Get(ctx, "b"); found {
+		t.Error("the least recently used entry was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, found, _ := cache.Get(ctx, key); !found {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	// Replacing a value refreshes the entry without growing the cache
+	cache.Set(ctx, "a", []byte("4"), time.Hour)
+	cache.Set(ctx, "d", []byte("5"), time.Hour)
+	if value, found, _ := cache.Get(ctx, "a"); !found || string(value) != "4" {
+		t.Errorf("Get(a) = %q, %v after replacing it", value, found)
+	}
+	if _, found, _ := cache.Get(ctx, "c"); found {
+		t.Error("c was kept over the replaced entry")
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	cache := NewLRUCache(10)
+	ctx := context.Background()
+
+	cache.Set(ctx, "short", []byte("1"), 10*time.Millisecond)
+	cache.Set(ctx, "long", []byte("2"), time.Hour)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, found, _ := cache.Get(ctx, "short"); found {
+		t.Error("expired entry returned")
+	}
+	if _, ok := cache.entries["short"]; ok {
+		t.Error("expired entry kept in memory")
+	}
+	if _, found, _ := cache.Get(ctx, "long"); !found {
+		t.Error("live entry expired")
+	}
+}
+
+func TestLRUCacheCopiesValues(t *testing.T) {
+	cache := NewLRUCache(10)
+	ctx := context.Background()
+
+	value := []byte("abc")
+	cache.Set(ctx, "key", value, time.Hour)
+	value[0] = 'x'
+	got, _, _ := cache.Get(ctx, "key")
+	got[1] = 'y'
+
+	if again, _, _ := cache.Get(ctx, "key"); string(again) != "abc" {
+		t.Errorf("cached value changed to %q", again)
+	}
+}
+
+// failingCache is a Cache whose server is down
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingCache) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestVideoInfoCacheStats(t *testing.T) {
+	fetches := 0
+	fetch := func(ctx context.Context, videoID string) (*VideoInfo, error) {
+		fetches++
+		if videoID == "missing" {
+			return nil, errors.New("video not found")
+		}
+		return &VideoInfo{Title: "Video " + videoID}, nil
+	}
+	ctx := context.Background()
+
+	videos := &VideoInfoCache{Cache: NewLRUCache(10), TTL: time.Hour, Fetch: fetch}
+	for _, id := range []string{"a", "a", "b", "a"} {
+		info, err := videos.GetVideoInfo(ctx, id)
+		if err != nil || info.Title != "Video "+id {
+			t.Fatalf("GetVideoInfo(%s) = %+v, %v", id, info, err)
+		}
+	}
+	if _, err := videos.GetVideoInfo(ctx, "missing"); err == nil {
+		t.Error("fetch error not returned")
+	}
+
+	want := CacheStats{Hits: 2, Misses: 3, HitRatio: 0.4}
+	if stats := videos.Stats(); stats != want || fetches != 3 {
+		t.Errorf("stats %+v after %d fetches, want %+v", stats, fetches, want)
+	}
+
+	// Cache failures are counted and the lookups go to YouTube
+	fetches = 0
+	videos = &VideoInfoCache{Cache: failingCache{}, TTL: time.Hour, Fetch: fetch}
+	for range 2 {
+		if _, err := videos.GetVideoInfo(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want = CacheStats{Misses: 2, Errors: 4}
+	if stats := videos.Stats(); stats != want || fetches != 2 {
+		t.Errorf("stats %+v after %d fetches, want %+v", stats, fetches, want)
+	}
+}
@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting a host that failed repeatedly
+var ErrCircuitOpen = errors.New("circuit breaker open: the remote service is unavailable")
+
+// OutboundConfig tunes the HTTP client used for calls to external services
+type OutboundConfig struct {
+	// Timeout bounds a whole call, retries included
+	Timeout time.Duration
+	// MaxRetries is the number of retries after a network error, a 5xx or a 429 response
+	MaxRetries int
+	// BaseBackoff and MaxBackoff bound the random delay before each retry
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// FailureThreshold consecutive failures open a host's circuit for Cooldown
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+// DefaultOutboundConfig is used for the settings left empty
+var DefaultOutboundConfig = OutboundConfig{
+	Timeout:          15 * time.Second,
+	MaxRetries:       2,
+	BaseBackoff:      200 * time.Millisecond,
+	MaxBackoff:       2 * time.Second,
+	FailureThreshold: 5,
+	Cooldown:         30 * time.Second,
+}
+
+// HTTPClient is the shared client for calls to external services. Services without
+// their own HTTPClient use it, so they share its timeouts and circuit breakers.
+var HTTPClient = NewOutboundClient(DefaultOutboundConfig)
+
+// NewOutboundClient returns an http.Client for external services. Connection and
+// response header timeouts keep a hung server from blocking a request, idempotent
+// requests are retried with jittered exponential backoff, and each host has a
+// circuit breaker that fails fast while the host is down.
+func NewOutboundClient(config OutboundConfig) *http.Client {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultOutboundConfig.Timeout
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = DefaultOutboundConfig.BaseBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultOutboundConfig.MaxBackoff
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultOutboundConfig.FailureThreshold
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultOutboundConfig.Cooldown
+	}
+
+	base := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   10,
+	}
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: &ResilientTransport{Base: base, Config: config},
+	}
+}
+
+// ResilientTransport adds retries and per-host circuit breakers to another RoundTripper
+type ResilientTransport struct {
+	Base   http.RoundTripper
+	Config OutboundConfig
+
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func (t *ResilientTransport) breaker(host string) *CircuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.breakers == nil {
+		t.breakers = map[string]*CircuitBreaker{}
+	}
+	breaker, ok := t.breakers[host]
+	if !ok {
+		breaker = &CircuitBreaker{FailureThreshold: t.Config.FailureThreshold, Cooldown: t.Config.Cooldown}
+		t.breakers[host] = breaker
+	}
+	return breaker
+}
+
+// CircuitStates returns the state of the circuit breaker of every host contacted so far
+func (t *ResilientTransport) CircuitStates() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	states := make(map[string]string, len(t.breakers))
+	for host, breaker := range t.breakers {
+		states[host] = breaker.State()
+	}
+	return states
+}
+
+// isRetryable reports whether a request can safely be sent again
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+// RoundTrip sends the request, retrying network errors, 5xx and 429 responses
+func (t *ResilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker := t.breaker(req.URL.Host)
+	retries := t.Config.MaxRetries
+	if !isRetryable(req) {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		allowed, trial := breaker.Allow()
+		if !allowed {
+			return nil, fmt.Errorf("%s: %w", req.URL.Host, ErrCircuitOpen)
+		}
+
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.Base.RoundTrip(req)
+		if err != nil && req.Context().Err() != nil {
+			// The caller gave up; this says nothing about the remote service
+			breaker.release(trial)
+			return nil, err
+		}
+
+		failed := err != nil || resp.StatusCode >= 500
+		breaker.Record(trial, !failed)
+
+		retryable := failed || resp.StatusCode == http.StatusTooManyRequests
+		if !retryable || attempt >= retries {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > delay {
+				delay = min(retryAfter, t.Config.MaxBackoff)
+			}
+			resp.Body.Close()
+		}
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns a random delay up to an exponentially growing bound ("full jitter")
+func (t *ResilientTransport) backoff(attempt int) time.Duration {
+	bound := t.Config.BaseBackoff << attempt
+	if bound <= 0 || bound > t.Config.MaxBackoff {
+		bound = t.Config.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(bound) + 1))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker opens after FailureThreshold consecutive failures and rejects calls
+// for Cooldown. It then lets a single trial call through: success closes the
+// circuit again, failure reopens it. Only the trial call ends the trial, so calls
+// made before the circuit opened cannot let a second trial through.
+type CircuitBreaker struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// Allow reports whether a call may be made now, and whether it is the trial call of
+// a half-open circuit. The caller passes trial on to Record or release.
+func (b *CircuitBreaker) Allow() (allowed, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.FailureThreshold {
+		return true, false
+	}
+	if time.Since(b.openedAt) < b.Cooldown || b.trial {
+		return false, false
+	}
+	b.trial = true
+	return true, true
+}
+
+// Record reports the outcome of a call
+func (b *CircuitBreaker) Record(trial, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial {
+		b.trial = false
+	}
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.FailureThreshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// release ends a call whose outcome is unknown, such as a canceled one
+func (b *CircuitBreaker) release(trial bool) {
+	if !trial {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// State returns closed, open or half-open
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.failures < b.FailureThreshold:
+		return CircuitClosed
+	case time.Since(b.openedAt) < b.Cooldown:
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
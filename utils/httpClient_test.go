@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer answers the first failures requests with status, then 200
+type flakyServer struct {
+	*httptest.Server
+	failures   int32
+	status     int
+	retryAfter string
+	requests   atomic.Int32
+}
+
+func newFlakyServer(t *testing.T, failures int32, status int) *flakyServer {
+	f := &flakyServer{failures: failures, status: status}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.requests.Add(1) <= atomic.LoadInt32(&f.failures) {
+			if f.retryAfter != "" {
+				w.Header().Set("Retry-After", f.retryAfter)
+			}
+			w.WriteHeader(f.status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// heal makes the server answer every later request with 200
+func (f *flakyServer) heal() {
+	atomic.StoreInt32(&f.failures, 0)
+}
+
+func testOutboundClient(config OutboundConfig) (*http.Client, *ResilientTransport) {
+	client := NewOutboundClient(config)
+	return client, client.Transport.(*ResilientTransport)
+}
+
+func TestOutboundClientRetries(t *testing.T) {
+	server := newFlakyServer(t, 2, http.StatusServiceUnavailable)
+	client, _ := testOutboundClient(OutboundConfig{MaxRetries: 2, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || server.requests.Load() != 3 {
+		t.Errorf("status %d after %d requests, want 200 after 3", resp.StatusCode, server.requests.Load())
+	}
+
+	// The last failure is returned once the retries are exhausted
+	server = newFlakyServer(t, 5, http.StatusBadGateway)
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || server.requests.Load() != 3 {
+		t.Errorf("status %d after %d requests, want 502 after 3", resp.StatusCode, server.requests.Load())
+	}
+
+	// Requests that are not idempotent are sent once
+	server = newFlakyServer(t, 1, http.StatusServiceUnavailable)
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || server.requests.Load() != 1 {
+		t.Errorf("POST got %d after %d requests", resp.StatusCode, server.requests.Load())
+	}
+
+	// Client errors are not retried
+	server = newFlakyServer(t, 1, http.StatusNotFound)
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if server.requests.Load() != 1 {
+		t.Errorf("404 retried: %d requests", server.requests.Load())
+	}
+}
+
+func TestOutboundClientRetryAfter(t *testing.T) {
+	server := newFlakyServer(t, 1, http.StatusTooManyRequests)
+	server.retryAfter = "120"
+	client, _ := testOutboundClient(OutboundConfig{MaxRetries: 1, BaseBackoff: time.Millisecond, MaxBackoff: 100 * time.Millisecond})
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	// Retry-After delays the retry, up to MaxBackoff
+	if resp.StatusCode != http.StatusOK || server.requests.Load() != 2 {
+		t.Errorf("status %d after %d requests, want 200 after 2", resp.StatusCode, server.requests.Load())
+	}
+	if elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("retried after %v, want MaxBackoff", elapsed)
+	}
+
+	tests := map[string]time.Duration{"3": 3 * time.Second, "0": 0, "": 0, "-1": 0, "Wed, 21 Oct 2026 07:28:00 GMT": 0}
+	for value, want := range tests {
+		if got := parseRetryAfter(value); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestOutboundClientBackoff(t *testing.T) {
+	transport := &ResilientTransport{Config: OutboundConfig{BaseBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}}
+
+	for attempt, bound := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond} {
+		seen := map[time.Duration]bool{}
+		for range 100 {
+			delay := transport.backoff(attempt)
+			if delay < 0 || delay > bound {
+				t.Fatalf("backoff(%d) = %v, want at most %v", attempt, delay, bound)
+			}
+			seen[delay] = true
+		}
+		if len(seen) < 10 {
+			t.Errorf("backoff(%d) took %d distinct values, want jitter", attempt, len(seen))
+		}
+	}
+
+	// A large attempt number does not overflow the bound
+	if delay := transport.backoff(80); delay < 0 || delay > 50*time.Millisecond {
+		t.Errorf("backoff(80) = %v", delay)
+	}
+}
+
+func TestOutboundClientCircuitBreaker(t *testing.T) {
+	server := newFlakyServer(t, 100, http.StatusInternalServerError)
+	client, transport := testOutboundClient(OutboundConfig{FailureThreshold: 2, Cooldown: 50 * time.Millisecond, BaseBackoff: time.Millisecond})
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	get := func() (*http.Response, error) {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	for range 2 {
+		if _, err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if state := transport.CircuitStates()[host]; state != CircuitOpen {
+		t.Fatalf("circuit %s after 2 failures, want open", state)
+	}
+
+	// An open circuit fails without contacting the server
+	if _, err := get(); !errors.Is(err, ErrCircuitOpen) || server.requests.Load() != 2 {
+		t.Errorf("error %v after %d requests, want ErrCircuitOpen after 2", err, server.requests.Load())
+	}
+
+	// After the cooldown a failed trial reopens the circuit
+	time.Sleep(60 * time.Millisecond)
+	if state := transport.CircuitStates()[host]; state != CircuitHalfOpen {
+		t.Fatalf("circuit %s after the cooldown, want half-open", state)
+	}
+	if _, err := get(); err != nil || server.requests.Load() != 3 {
+		t.Fatalf("trial error %v after %d requests", err, server.requests.Load())
+	}
+	if _, err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("error %v after a failed trial, want ErrCircuitOpen", err)
+	}
+
+	// and a successful one closes it
+	server.heal()
+	time.Sleep(60 * time.Millisecond)
+	if resp, err := get(); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("trial failed: %v", err)
+	}
+	if state := transport.CircuitStates()[host]; state != CircuitClosed {
+		t.Errorf("circuit %s after a successful trial, want closed", state)
+	}
+}
+
+func TestCircuitBreakerSingleTrial(t *testing.T) {
+	breaker := &CircuitBreaker{FailureThreshold: 1, Cooldown: 20 * time.Millisecond}
+
+	// A call made while the circuit is closed
+	allowed, early := breaker.Allow()
+	if !allowed || early {
+		t.Fatalf("Allow = %v, %v on a closed circuit", allowed, early)
+	}
+	allowed, trial := breaker.Allow()
+	breaker.Record(trial, false)
+	if allowed, _ := breaker.Allow(); allowed || breaker.State() != CircuitOpen {
+		t.Fatalf("call allowed on a %s circuit", breaker.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	allowed, trial = breaker.Allow()
+	if !allowed || !trial {
+		t.Fatalf("Allow = %v, %v on a half-open circuit, want the trial", allowed, trial)
+	}
+	if allowed, _ := breaker.Allow(); allowed {
+		t.Error("second call allowed during the trial")
+	}
+
+	// The early call ends without ending the trial
+	breaker.release(early)
+	if allowed, _ := breaker.Allow(); allowed {
+		t.Error("second trial allowed after an earlier call was released")
+	}
+	breaker.Record(early, false)
+	time.Sleep(30 * time.Millisecond)
+	if allowed, _ := breaker.Allow(); allowed {
+		t.Error("second trial allowed after an earlier call failed")
+	}
+
+	breaker.Record(trial, true)
+	if allowed, _ := breaker.Allow(); !allowed || breaker.State() != CircuitClosed {
+		t.Errorf("circuit %s after a successful trial", breaker.State())
+	}
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+
+	// Register the decoders of the accepted upload formats
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ErrUnsupportedImage is returned for uploads that are not JPEG, PNG or GIF images
+var ErrUnsupportedImage = errors.New("unsupported image type")
+
+// ErrImageTooLarge is returned for images whose dimensions exceed the limit
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// imageExtensions maps the accepted image types to file extensions
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// DecodeImage sniffs the content type of an upload from its bytes, ignoring the type
+// declared by the client, and decodes it. Images with more than maxPixels pixels are
+// rejected before decoding so small files cannot expand into huge bitmaps.
+func DecodeImage(data []byte, maxPixels int) (image.Image, string, string, error) {
+	contentType := http.DetectContentType(data)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, "", "", ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", "", ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, "", "", ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", "", ErrUnsupportedImage
+	}
+	return img, contentType, extension, nil
+}
+
+// FlattenImage returns an opaque RGBA copy of an image with transparent areas
+// drawn on white, ready for ResizeToFit and JPEG encoding
+func FlattenImage(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+	return flat
+}
+
+// ResizeToFit scales an image returned by FlattenImage down so that neither side exceeds size,
+// keeping its aspect ratio. Each target pixel is the average of the source pixels
+// it covers. Images that already fit are returned as is.
+func ResizeToFit(flat *image.RGBA, size int) image.Image {
+	width, height := flat.Bounds().Dx(), flat.Bounds().Dy()
+	if width <= size && height <= size {
+		return flat
+	}
+
+	newWidth, newHeight := size, size
+	if width > height {
+		newHeight = max(1, height*size/width)
+	} else {
+		newWidth = max(1, width*size/height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0, y1 := y*height/newHeight, max((y+1)*height/newHeight, y*height/newHeight+1)
+		for x := 0; x < newWidth; x++ {
+			x0, x1 := x*width/newWidth, max((x+1)*width/newWidth, x*width/newWidth+1)
+
+			var r, g, b, count int
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					b += int(row[sx*4+2])
+					count++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / count)
+			dst.Pix[i+1] = uint8(g / count)
+			dst.Pix[i+2] = uint8(b / count)
+			dst.Pix[i+3] = 255
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG encodes an image as a JPEG file
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
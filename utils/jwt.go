@@ -1,35 +1,218 @@
 package utils
 
 import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte(getJWTSecret())
+// MinJWTSecretLength is the minimum length accepted for HMAC secrets
+const MinJWTSecretLength = 32
+
+// weakJWTSecrets are well-known placeholder values that must never be used
+var weakJWTSecrets = []string{
+	"default-jwt",
+	"secret",
+	"changeme",
+	"your-secret-jwt-key-change-in-production",
+}
 
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
+	UserID       uint   `json:"user_id"`
+	Email        string `json:"email"`
+	TokenVersion uint   `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
+// JWTKey is a key used to sign and/or verify tokens, identified by the kid header
+type JWTKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+var (
+	jwtMu         sync.RWMutex
+	jwtSigningKey *JWTKey
+	jwtKeys       = map[string]*JWTKey{}
+)
+
+// SetJWTKeys installs the key used to sign new tokens and any additional keys
+// still accepted for verification, typically keys being rotated out
+func SetJWTKeys(signing JWTKey, verifyOnly ...JWTKey) error {
+	if signing.SignKey == nil {
+		return errors.New("the signing key has no private part")
+	}
+
+	keys := map[string]*JWTKey{}
+	for _, k := range append([]JWTKey{signing}, verifyOnly...) {
+		k := k
+		if k.ID == "" {
+			return errors.New("every JWT key needs an ID")
+		}
+		if _, exists := keys[k.ID]; exists {
+			return fmt.Errorf("duplicate JWT key ID %q", k.ID)
+		}
+		keys[k.ID] = &k
+	}
+
+	jwtMu.Lock()
+	defer jwtMu.Unlock()
+	jwtSigningKey = keys[signing.ID]
+	jwtKeys = keys
+	return nil
+}
+
+// ValidateJWTSecret rejects HMAC secrets that are too short or well-known placeholders
+func ValidateJWTSecret(secret string) error {
 	if secret == "" {
-		return "default-jwt"
+		return errors.New("JWT_SECRET is not set")
+	}
+	for _, weak := range weakJWTSecrets {
+		if strings.EqualFold(secret, weak) {
+			return errors.New("JWT_SECRET is a well-known placeholder value")
+		}
+	}
+	if len(secret) < MinJWTSecretLength {
+		return fmt.Errorf("JWT_SECRET must be at least %d characters long", MinJWTSecretLength)
+	}
+	return nil
+}
+
+// NewHMACKey creates an HS256 key from a shared secret
+func NewHMACKey(kid string, secret []byte) JWTKey {
+	return JWTKey{ID: kid, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}
+}
+
+// LoadPrivateKeyPEM reads an RSA (RS256) or Ed25519 (EdDSA) private key from a PEM file
+func LoadPrivateKeyPEM(kid, path string) (JWTKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return JWTKey{}, err
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return JWTKey{}, fmt.Errorf("error parsing private key %s: %v", path, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return JWTKey{ID: kid, Method: jwt.SigningMethodRS256, SignKey: k, VerifyKey: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return JWTKey{ID: kid, Method: jwt.SigningMethodEdDSA, SignKey: k, VerifyKey: k.Public()}, nil
+	}
+	return JWTKey{}, fmt.Errorf("unsupported private key type in %s (RSA or Ed25519 expected)", path)
+}
+
+// LoadPublicKeyPEM reads an RSA or Ed25519 public key, used to verify tokens only
+func LoadPublicKeyPEM(kid, path string) (JWTKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return JWTKey{}, err
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return JWTKey{}, fmt.Errorf("error parsing public key %s: %v", path, err)
 	}
-	return secret
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JWTKey{ID: kid, Method: jwt.SigningMethodRS256, VerifyKey: k}, nil
+	case ed25519.PublicKey:
+		return JWTKey{ID: kid, Method: jwt.SigningMethodEdDSA, VerifyKey: k}, nil
+	}
+	return JWTKey{}, fmt.Errorf("unsupported public key type in %s (RSA or Ed25519 expected)", path)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
 }
 
-func GenerateToken(userID uint, email string) (string, error) {
+// SignClaims signs arbitrary claims with the current signing key and sets the kid header
+func SignClaims(claims jwt.Claims) (string, error) {
+	jwtMu.RLock()
+	key := jwtSigningKey
+	jwtMu.RUnlock()
+
+	if key == nil {
+		return "", errors.New("JWT keys are not configured")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey)
+}
+
+// ParseClaims verifies a token against the configured keys and decodes it into claims
+func ParseClaims(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		jwtMu.RLock()
+		defer jwtMu.RUnlock()
+
+		key := jwtSigningKey
+		if kid, ok := token.Header["kid"].(string); ok {
+			key = jwtKeys[kid]
+		}
+		if key == nil || key.VerifyKey == nil {
+			return nil, errors.New("clé de signature inconnue")
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("méthode de signature invalide")
+		}
+		return key.VerifyKey, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !token.Valid {
+		return errors.New("token invalide")
+	}
+	return nil
+}
+
+func GenerateToken(userID uint, email string, tokenVersion uint) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:       userID,
+		Email:        email,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -38,30 +221,59 @@ func GenerateToken(userID uint, email string) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
-	if err != nil {
-		return "", err
+	return SignClaims(claims)
+}
+
+func ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := ParseClaims(tokenString, claims); err != nil {
+		return nil, err
 	}
 
-	return tokenString, nil
+	// Tokens minted for another purpose carry an audience and are not session tokens
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("token invalide")
+	}
+	return claims, nil
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("méthode de signature invalide")
-		}
-		return jwtSecret, nil
-	})
+// JWKS returns the public keys in JSON Web Key Set format.
+// HMAC keys are secret and are never published.
+func JWKS() map[string]interface{} {
+	jwtMu.RLock()
+	defer jwtMu.RUnlock()
 
-	if err != nil {
-		return nil, err
+	ids := make([]string, 0, len(jwtKeys))
+	for id := range jwtKeys {
+		ids = append(ids, id)
 	}
+	sort.Strings(ids)
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	keys := []map[string]interface{}{}
+	for _, id := range ids {
+		key := jwtKeys[id]
+		var jwk map[string]interface{}
+		switch pub := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk = map[string]interface{}{
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			}
+		case ed25519.PublicKey:
+			jwk = map[string]interface{}{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			}
+		default:
+			continue
+		}
+		jwk["kid"] = key.ID
+		jwk["alg"] = key.Method.Alg()
+		jwk["use"] = "sig"
+		keys = append(keys, jwk)
 	}
 
-	return nil, errors.New("token invalide")
+	return map[string]interface{}{"keys": keys}
 }
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the ID of the request being served
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewLogger returns a logger writing JSON lines to w. Records logged with a
+// context carrying a request ID get a request_id attribute.
+func NewLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(requestIDHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// requestIDHandler adds the request ID of the record's context to the record
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// GormLogger routes the SQL logs of GORM through a slog logger: statements at
+// debug level, statements slower than SlowThreshold at warn level and failed
+// statements at error level. A zero SlowThreshold disables the slow query logs.
+// Statements are logged with placeholders instead of their values, which can be
+// password hashes, tokens or email addresses.
+type GormLogger struct {
+	Logger        *slog.Logger
+	SlowThreshold time.Duration
+}
+
+// LogMode implements gormlogger.Interface; the level is the one of the slog logger
+func (l *GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+// Info implements gormlogger.Interface
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.Logger.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// Warn implements gormlogger.Interface
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.Logger.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// Error implements gormlogger.Interface
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.Logger.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// ParamsFilter implements gorm.ParamsFilter: dropping the values keeps the
+// placeholders in the logged statements
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+// Trace implements gormlogger.Interface, it is called after every statement
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	slow := l.SlowThreshold > 0 && elapsed > l.SlowThreshold
+
+	// A missing record is an expected outcome, not a failure
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+
+	level := slog.LevelDebug
+	msg := "SQL query"
+	switch {
+	case failed:
+		level = slog.LevelError
+		msg = "SQL query failed"
+	case slow:
+		level = slog.LevelWarn
+		msg = "Slow SQL query"
+	}
+	if !l.Logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("elapsed_ms", Milliseconds(elapsed)),
+	}
+	if failed {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	if slow {
+		attrs = append(attrs, slog.Float64("threshold_ms", Milliseconds(l.SlowThreshold)))
+	}
+	l.Logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// Milliseconds returns d in milliseconds with microsecond precision, for log attributes
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
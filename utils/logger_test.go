@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// logLines decodes the JSON lines written by a logger
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		lines = append(lines, entry)
+	}
+	buf.Reset()
+	return lines
+}
+
+func TestLoggerRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, slog.LevelInfo).With("component", "test")
+
+	logger.InfoContext(ContextWithRequestID(context.Background(), "abc123"), "served")
+	logger.Info("startup")
+	logger.Debug("hidden")
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %v", len(lines), lines)
+	}
+	if lines[0]["request_id"] != "abc123" || lines[0]["component"] != "test" {
+		t.Errorf("request line %v", lines[0])
+	}
+	if _, ok := lines[1]["request_id"]; ok {
+		t.Errorf("request ID without a request: %v", lines[1])
+	}
+}
+
+func TestGormLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &GormLogger{Logger: NewLogger(&buf, slog.LevelInfo), SlowThreshold: 100 * time.Millisecond}
+	ctx := ContextWithRequestID(context.Background(), "abc123")
+	query := func() (string, int64) { return "SELECT 1", 1 }
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		err     error
+		level   string
+	}{
+		{"fast query", time.Millisecond, nil, ""},
+		{"missing record", time.Millisecond, gorm.ErrRecordNotFound, ""},
+		{"slow query", time.Second, nil, "WARN"},
+		{"failed query", time.Millisecond, errors.New("no such table"), "ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger.Trace(ctx, time.Now().Add(-tt.elapsed), query, tt.err)
+			lines := logLines(t, &buf)
+			if tt.level == "" {
+				if len(lines) != 0 {
+					t.Errorf("logged at info level: %v", lines)
+				}
+				return
+			}
+			if len(lines) != 1 || lines[0]["level"] != tt.level || lines[0]["sql"] != "SELECT 1" || lines[0]["request_id"] != "abc123" {
+				t.Errorf("got %v, want one %s line", lines, tt.level)
+			}
+		})
+	}
+}
+
+func TestGormLoggerHidesValues(t *testing.T) {
+	var buf bytes.Buffer
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: &GormLogger{Logger: NewLogger(&buf, slog.LevelDebug)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	type account struct {
+		ID       uint
+		Email    string
+		Password string
+	}
+	if err := db.AutoMigrate(&account{}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+
+	db.Create(&account{Email: "alice@example.com", Password: "$2a$10$secrethash"})
+	db.Where("email = ?", "alice@example.com").First(&account{})
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("got %d SQL lines, want 2: %v", len(lines), lines)
+	}
+	for _, line := range lines {
+		sql, _ := line["sql"].(string)
+		if strings.Contains(sql, "alice@example.com") || strings.Contains(sql, "secrethash") || !strings.Contains(sql, "?") {
+			t.Errorf("logged %q, want placeholders", sql)
+		}
+	}
+}
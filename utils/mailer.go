@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends plain-text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the email using net/smtp, authenticating when credentials are set
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	addr := net.JoinHostPort(m.Host, m.Port)
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg := buildMessage(m.From, to, subject, body)
+	if err := smtp.SendMail(addr, auth, m.From, []string{to}, msg); err != nil {
+		return fmt.Errorf("error sending email to %s: %v", to, err)
+	}
+	return nil
+}
+
+// LogMailer is a stand-in for local development and tests.
+// Emails are appended to the file at Path, or written to the standard logger when Path is empty.
+type LogMailer struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Send records the email instead of delivering it
+func (m *LogMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Path == "" {
+		slog.Info("Email logged instead of sent", "to", to, "subject", subject, "body", body)
+		return nil
+	}
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening mail log: %v", err)
+	}
+	defer f.Close()
+
+	entry := fmt.Sprintf("=== %s ===\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), to, subject, body)
+	if _, err := f.WriteString(entry); err != nil {
+		return fmt.Errorf("error writing mail log: %v", err)
+	}
+	return nil
+}
+
+func buildMessage(from, to, subject, body string) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + to + "\r\n")
+	sb.WriteString("Subject: " + subject + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(body)
+	return []byte(sb.String())
+}
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReleaseNotFound is returned when no release matches an album
+var ErrReleaseNotFound = errors.New("no matching release found")
+
+// ReleaseMetadata is the information used to enrich an album
+type ReleaseMetadata struct {
+	MBID        string
+	Title       string
+	Artist      string
+	ReleaseYear int
+	Label       string
+	CoverArtURL string
+	Tracks      []ReleaseTrack
+}
+
+// ReleaseTrack is a track of a release, numbered across all its media
+type ReleaseTrack struct {
+	Position int
+	Title    string
+	LengthMs int
+}
+
+// MetadataClient looks up release metadata. The MusicBrainz client implements it;
+// tests can replace it with a client returning recorded responses.
+type MetadataClient interface {
+	// SearchRelease returns the MBID of the release that best matches an artist and title
+	SearchRelease(ctx context.Context, artist, title string) (string, error)
+	// LookupRelease returns the metadata of a release, including its cover art when available
+	LookupRelease(ctx context.Context, mbid string) (*ReleaseMetadata, error)
+}
+
+// MusicBrainzClient reads the MusicBrainz web service and the Cover Art Archive.
+// MusicBrainz asks clients to identify themselves and to send at most one request per second.
+type MusicBrainzClient struct {
+	BaseURL     string
+	CoverArtURL string
+	UserAgent   string
+	HTTPClient  *http.Client
+
+	mu          sync.Mutex
+	lastRequest time.Time
+}
+
+// NewMusicBrainzClient returns a client for the public MusicBrainz and Cover Art Archive services
+func NewMusicBrainzClient(userAgent string) *MusicBrainzClient {
+	return &MusicBrainzClient{
+		BaseURL:     "https://musicbrainz.org/ws/2",
+		CoverArtURL: "https://coverartarchive.org",
+		UserAgent:   userAgent,
+	}
+}
+
+func (m *MusicBrainzClient) client() *http.Client {
+	if m.HTTPClient != nil {
+		return m.HTTPClient
+	}
+	return HTTPClient
+}
+
+// throttle spaces MusicBrainz requests by at least a second
+func (m *MusicBrainzClient) throttle(ctx context.Context) error {
+	m.mu.Lock()
+	wait := time.Until(m.lastRequest.Add(time.Second))
+	if wait < 0 {
+		wait = 0
+	}
+	m.lastRequest = time.Now().Add(wait)
+	m.mu.Unlock()
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// getJSON decodes the response of endpoint into v; a 404 is reported as ErrReleaseNotFound
+func (m *MusicBrainzClient) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", m.UserAgent)
+
+	resp, err := m.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrReleaseNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP error %d from %s", resp.StatusCode, endpoint)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// luceneQuote quotes a value for the MusicBrainz search syntax
+func luceneQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// SearchRelease searches MusicBrainz for the release and returns the best match
+func (m *MusicBrainzClient) SearchRelease(ctx context.Context, artist, title string) (string, error) {
+	query := "release:" + luceneQuote(title)
+	if artist != "" {
+		query += " AND artist:" + luceneQuote(artist)
+	}
+
+	if err := m.throttle(ctx); err != nil {
+		return "", err
+	}
+	var result struct {
+		Releases []struct {
+			ID    string `json:"id"`
+			Score int    `json:"score"`
+		} `json:"releases"`
+	}
+	endpoint := fmt.Sprintf("%s/release/?query=%s&limit=1&fmt=json", m.BaseURL, url.QueryEscape(query))
+	if err := m.getJSON(ctx, endpoint, &result); err != nil {
+		return "", err
+	}
+
+	// Scores go from 0 to 100; weak matches are more likely to be another album
+	if len(result.Releases) == 0 || result.Releases[0].Score < 80 {
+		return "", ErrReleaseNotFound
+	}
+	return result.Releases[0].ID, nil
+}
+
+// LookupRelease fetches a release with its label and tracks, then its front cover
+func (m *MusicBrainzClient) LookupRelease(ctx context.Context, mbid string) (*ReleaseMetadata, error) {
+	if err := m.throttle(ctx); err != nil {
+		return nil, err
+	}
+	var release struct {
+		ID           string `json:"id"`
+		Title        string `json:"title"`
+		Date         string `json:"date"`
+		ArtistCredit []struct {
+			Name       string `json:"name"`
+			JoinPhrase string `json:"joinphrase"`
+		} `json:"artist-credit"`
+		LabelInfo []struct {
+			Label *struct {
+				Name string `json:"name"`
+			} `json:"label"`
+		} `json:"label-info"`
+		Media []struct {
+			Tracks []struct {
+				Title  string `json:"title"`
+				Length *int   `json:"length"`
+			} `json:"tracks"`
+		} `json:"media"`
+	}
+	endpoint := fmt.Sprintf("%s/release/%s?inc=artist-credits+labels+recordings&fmt=json", m.BaseURL, url.PathEscape(mbid))
+	if err := m.getJSON(ctx, endpoint, &release); err != nil {
+		return nil, err
+	}
+
+	metadata := &ReleaseMetadata{MBID: release.ID, Title: release.Title}
+	for _, credit := range release.ArtistCredit {
+		metadata.Artist += credit.Name + credit.JoinPhrase
+	}
+	if len(release.Date) >= 4 {
+		metadata.ReleaseYear, _ = strconv.Atoi(release.Date[:4])
+	}
+	for _, info := range release.LabelInfo {
+		if info.Label != nil {
+			metadata.Label = info.Label.Name
+			break
+		}
+	}
+	for _, medium := range release.Media {
+		for _, track := range medium.Tracks {
+			t := ReleaseTrack{Position: len(metadata.Tracks) + 1, Title: track.Title}
+			if track.Length != nil {
+				t.LengthMs = *track.Length
+			}
+			metadata.Tracks = append(metadata.Tracks, t)
+		}
+	}
+
+	coverArtURL, err := m.frontCover(ctx, release.ID)
+	if err != nil && !errors.Is(err, ErrReleaseNotFound) {
+		return nil, err
+	}
+	metadata.CoverArtURL = coverArtURL
+	return metadata, nil
+}
+
+// frontCover returns the URL of the release's front cover in the Cover Art Archive
+func (m *MusicBrainzClient) frontCover(ctx context.Context, mbid string) (string, error) {
+	var result struct {
+		Images []struct {
+			Front      bool              `json:"front"`
+			Image      string            `json:"image"`
+			Thumbnails map[string]string `json:"thumbnails"`
+		} `json:"images"`
+	}
+	if err := m.getJSON(ctx, fmt.Sprintf("%s/release/%s", m.CoverArtURL, url.PathEscape(mbid)), &result); err != nil {
+		return "", err
+	}
+
+	for _, image := range result.Images {
+		if !image.Front {
+			continue
+		}
+		// Prefer a reasonably sized thumbnail over the full resolution scan
+		if thumbnail := image.Thumbnails["500"]; thumbnail != "" {
+			return thumbnail, nil
+		}
+		return image.Image, nil
+	}
+	return "", nil
+}
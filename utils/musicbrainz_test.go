@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The fixtures in testdata/musicbrainz follow the responses of musicbrainz.org and
+// coverartarchive.org, trimmed down to the fields the client reads.
+
+const testMBID = "b1a9c0e9-d987-4042-ae91-78d6a3267d69"
+
+// mbResponse is the answer of the stand-in to a path: a fixture, or an empty body with the status
+type mbResponse struct {
+	status  int
+	fixture string
+}
+
+// replayMusicBrainz serves the responses by request path, MusicBrainz under /ws/2 and
+// the Cover Art Archive under /caa. Unknown paths answer with a 404. The client's
+// requests are recorded in the returned log.
+func replayMusicBrainz(t *testing.T, responses map[string]mbResponse) (*MusicBrainzClient, *requestLog) {
+	t.Helper()
+	bodies := map[string][]byte{}
+	for path, response := range responses {
+		if response.fixture == "" {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join("testdata", "musicbrainz", response.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[path] = body
+	}
+
+	log := &requestLog{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if response.status != 0 {
+			w.WriteHeader(response.status)
+		}
+		w.Write(bodies[r.URL.Path])
+	}))
+	t.Cleanup(server.Close)
+
+	return &MusicBrainzClient{
+		BaseURL:     server.URL + "/ws/2",
+		CoverArtURL: server.URL + "/caa",
+		UserAgent:   "web-service-gin-tests/1.0 (tests@example.com)",
+		HTTPClient:  server.Client(),
+	}, log
+}
+
+// requestLog records the requests received by a stand-in server
+type requestLog struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	times    []time.Time
+}
+
+func (l *requestLog) add(r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests = append(l.requests, r)
+	l.times = append(l.times, time.Now())
+}
+
+func TestMusicBrainzSearchRelease(t *testing.T) {
+	client, log := replayMusicBrainz(t, map[string]mbResponse{"/ws/2/release/": {fixture: "search.json"}})
+
+	mbid, err := client.SearchRelease(context.Background(), "John Coltrane", `Blue "Train"`)
+	if err != nil || mbid != testMBID {
+		t.Fatalf("SearchRelease = %q, %v", mbid, err)
+	}
+
+	r := log.requests[0]
+	query := r.URL.Query()
+	if want := `release:"Blue \"Train\"" AND artist:"John Coltrane"`; query.Get("query") != want {
+		t.Errorf("query %q, want %q", query.Get("query"), want)
+	}
+	if query.Get("fmt") != "json" || query.Get("limit") != "1" {
+		t.Errorf("unexpected request %s", r.URL)
+	}
+	if r.Header.Get("User-Agent") != client.UserAgent || r.Header.Get("Accept") != "application/json" {
+		t.Errorf("unexpected headers %v", r.Header)
+	}
+}
+
+func TestMusicBrainzSearchWithoutMatch(t *testing.T) {
+	tests := map[string]mbResponse{
+		"weak match":  {fixture: "search_weak.json"},
+		"no release":  {fixture: "search_empty.json"},
+		"server down": {status: http.StatusServiceUnavailable},
+	}
+	for name, response := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, _ := replayMusicBrainz(t, map[string]mbResponse{"/ws/2/release/": response})
+			_, err := client.SearchRelease(context.Background(), "John Coltrane", "Blue Train")
+			if notFound := errors.Is(err, ErrReleaseNotFound); notFound != (response.status == 0) {
+				t.Errorf("SearchRelease error %v", err)
+			}
+		})
+	}
+}
+
+func TestMusicBrainzLookupRelease(t *testing.T) {
+	client, log := replayMusicBrainz(t, map[string]mbResponse{
+		"/ws/2/release/" + testMBID: {fixture: "release.json"},
+		"/caa/release/" + testMBID:  {fixture: "cover_art.json"},
+	})
+
+	release, err := client.LookupRelease(context.Background(), testMBID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.MBID != testMBID || release.Title != "Blue Train" || release.Artist != "John Coltrane & Lee Morgan" ||
+		release.ReleaseYear != 1957 || release.Label != "Blue Note" {
+		t.Errorf("unexpected release %+v", release)
+	}
+	if want := "https://coverartarchive.org/release/" + testMBID + "/1000-500.jpg"; release.CoverArtURL != want {
+		t.Errorf("cover %q, want the 500px front thumbnail", release.CoverArtURL)
+	}
+
+	// Tracks are numbered across media; unknown lengths stay at zero
+	want := []ReleaseTrack{
+		{Position: 1, Title: "Blue Train", LengthMs: 643000},
+		{Position: 2, Title: "Moment's Notice", LengthMs: 550000},
+		{Position: 3, Title: "Locomotion"},
+		{Position: 4, Title: "I'm Old Fashioned", LengthMs: 478000},
+	}
+	if len(release.Tracks) != len(want) {
+		t.Fatalf("got %d tracks, want %d", len(release.Tracks), len(want))
+	}
+	for i := range want {
+		if release.Tracks[i] != want[i] {
+			t.Errorf("track %d = %+v, want %+v", i, release.Tracks[i], want[i])
+		}
+	}
+
+	if inc := log.requests[0].URL.Query().Get("inc"); inc != "artist-credits labels recordings" {
+		t.Errorf("release requested with inc=%q", inc)
+	}
+}
+
+func TestMusicBrainzCoverArt(t *testing.T) {
+	tests := []struct {
+		name    string
+		cover   mbResponse
+		want    string
+		wantErr bool
+	}{
+		{"full image without thumbnails", mbResponse{fixture: "cover_art_no_thumbnails.json"}, "https://coverartarchive.org/release/" + testMBID + "/1000.jpg", false},
+		{"no cover art", mbResponse{status: http.StatusNotFound}, "", false},
+		{"archive down", mbResponse{status: http.StatusBadGateway}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := replayMusicBrainz(t, map[string]mbResponse{
+				"/ws/2/release/" + testMBID: {fixture: "release.json"},
+				"/caa/release/" + testMBID:  tt.cover,
+			})
+			release, err := client.LookupRelease(context.Background(), testMBID)
+			if tt.wantErr {
+				if err == nil || errors.Is(err, ErrReleaseNotFound) {
+					t.Errorf("LookupRelease error %v", err)
+				}
+				return
+			}
+			if err != nil || release.CoverArtURL != tt.want {
+				t.Errorf("LookupRelease cover %q, %v; want %q", release.CoverArtURL, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMusicBrainzUnknownRelease(t *testing.T) {
+	client, _ := replayMusicBrainz(t, nil)
+	if _, err := client.LookupRelease(context.Background(), testMBID); !errors.Is(err, ErrReleaseNotFound) {
+		t.Errorf("LookupRelease error %v, want ErrReleaseNotFound", err)
+	}
+}
+
+func TestMusicBrainzRateLimit(t *testing.T) {
+	t.Parallel()
+	client, log := replayMusicBrainz(t, map[string]mbResponse{
+		"/ws/2/release/":            {fixture: "search.json"},
+		"/ws/2/release/" + testMBID: {fixture: "release.json"},
+		"/caa/release/" + testMBID:  {fixture: "cover_art.json"},
+	})
+
+	ctx := context.Background()
+	if _, err := client.SearchRelease(ctx, "John Coltrane", "Blue Train"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.LookupRelease(ctx, testMBID); err != nil {
+		t.Fatal(err)
+	}
+
+	// MusicBrainz requests are a second apart; the Cover Art Archive is not throttled
+	var musicBrainz []time.Time
+	for i, r := range log.requests {
+		if strings.HasPrefix(r.URL.Path, "/ws/2/") {
+			musicBrainz = append(musicBrainz, log.times[i])
+		}
+	}
+	if len(musicBrainz) != 2 {
+		t.Fatalf("%d MusicBrainz requests, want 2", len(musicBrainz))
+	}
+	if gap := musicBrainz[1].Sub(musicBrainz[0]); gap < 990*time.Millisecond {
+		t.Errorf("requests %v apart, want at least a second", gap)
+	}
+
+	// A cancelled context stops waiting for the next slot
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.SearchRelease(cancelled, "John Coltrane", "Blue Train"); !errors.Is(err, context.Canceled) {
+		t.Errorf("SearchRelease error %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadRESP(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  interface{}
+	}{
+		{"+OK\r\n", []byte("OK")},
+		{":42\r\n", int64(42)},
+		{"$5\r\nhello\r\n", []byte("hello")},
+		{"$7\r\nline\r\nx\r\n", []byte("line\r\nx")},
+		{"$0\r\n\r\n", []byte{}},
+		{"$-1\r\n", nil},
+		{"*-1\r\n", nil},
+		{"*2\r\n$3\r\nGET\r\n:1\r\n", []interface{}{[]byte("GET"), int64(1)}},
+	}
+	for _, tt := range tests {
+		got, err := readRESP(bufio.NewReader(strings.NewReader(tt.reply)))
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("readRESP(%q) = %#v, %v; want %#v", tt.reply, got, err, tt.want)
+		}
+	}
+
+	if _, err := readRESP(bufio.NewReader(strings.NewReader("-WRONGPASS invalid password\r\n"))); err != redisError("WRONGPASS invalid password") {
+		t.Errorf("error reply read as %v", err)
+	}
+	for _, reply := range []string{"", "\r\n", "?what\r\n", "$5\r\nhi\r\n", ":x\r\n", "*2\r\n+OK\r\n"} {
+		if got, err := readRESP(bufio.NewReader(strings.NewReader(reply))); err == nil {
+			t.Errorf("readRESP(%q) = %#v, want an error", reply, got)
+		}
+	}
+}
+
+func TestNewRedisCache(t *testing.T) {
+	cache, err := NewRedisCache("redis://:secret@cache.internal/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Addr != "cache.internal:6379" || cache.Password != "secret" || cache.DB != 2 {
+		t.Errorf("unexpected cache %+v", cache)
+	}
+
+	for _, url := range []string{"http://cache.internal", "redis://", "redis://cache.internal/db"} {
+		if _, err := NewRedisCache(url); err == nil {
+			t.Errorf("NewRedisCache(%q) accepted", url)
+		}
+	}
+}
+
+// fakeRedis serves canned replies to the commands of a RedisCache on a loopback listener
+type fakeRedis struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	values      map[string]string
+	commands    []string
+	connections int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeRedis{listener: listener, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.connections++
+			server.mu.Unlock()
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		// Commands are arrays of bulk strings, which readRESP reads as well
+		command, err := readRESP(reader)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range command.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		reply := f.reply(args)
+		f.mu.Unlock()
+
+		if reply == "" {
+			// Drop the connection, as a restarting server would
+			return
+		}
+		conn.Write([]byte(reply))
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	switch args[0] {
+	case "AUTH":
+		if args[1] != "secret" {
+			return "-WRONGPASS invalid username-password pair\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		f.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "GET":
+		switch args[1] {
+		case "hangup":
+			return ""
+		case "wrongtype":
+			return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+		}
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (f *fakeRedis) log() ([]string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...), f.connections
+}
+
+func TestRedisCache(t *testing.T) {
+	server := newFakeRedis(t)
+	cache := &RedisCache{Addr: server.listener.Addr().String(), Password: "secret", DB: 3, Timeout: time.Second}
+	ctx := context.Background()
+
+	if err := cache.Set(ctx, "youtube:video:a", []byte("value\r\nwith a line break"), 90*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	value, found, err := cache.Get(ctx, "youtube:video:a")
+	if err != nil || !found || string(value) != "value\r\nwith a line break" {
+		t.Errorf("Get = %q, %v, %v", value, found, err)
+	}
+	if _, found, err := cache.Get(ctx, "youtube:video:b"); found || err != nil {
+		t.Errorf("missing key: found %v, %v", found, err)
+	}
+
+	// Error replies keep the connection, network errors drop it
+	if _, _, err := cache.Get(ctx, "wrongtype"); err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Errorf("Get error %v", err)
+	}
+	if _, _, err := cache.Get(ctx, "hangup"); err == nil {
+		t.Error("Get succeeded on a closed connection")
+	}
+	if _, found, err := cache.Get(ctx, "youtube:video:a"); !found || err != nil {
+		t.Errorf("Get after reconnecting: found %v, %v", found, err)
+	}
+
+	commands, connections := server.log()
+	want := []string{
+		"AUTH secret", "SELECT 3",
+		"SET youtube:video:a value\r\nwith a line break PX 90000",
+		"GET youtube:video:a", "GET youtube:video:b", "GET wrongtype", "GET hangup",
+		"AUTH secret", "SELECT 3",
+		"GET youtube:video:a",
+	}
+	if !reflect.DeepEqual(commands, want) || connections != 2 {
+		t.Errorf("server received %q over %d connections, want %q over 2", commands, connections, want)
+	}
+}
+
+func TestRedisCacheWrongPassword(t *testing.T) {
+	server := newFakeRedis(t)
+	cache := &RedisCache{Addr: server.listener.Addr().String(), Password: "wrong", Timeout: time.Second}
+
+	if _, _, err := cache.Get(context.Background(), "key"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Get error %v", err)
+	}
+	if cache.conn != nil {
+		t.Error("connection kept after a failed AUTH")
+	}
+}
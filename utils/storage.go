@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrObjectNotFound is returned by Storage.Get when no object has the key
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage stores binary objects such as images under slash-separated keys
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the object content and its content type; the caller closes the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// CleanStorageKey normalises a key and rejects keys escaping the storage root
+func CleanStorageKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", errors.New("invalid storage key")
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
+
+// LocalStorage keeps objects as files below a directory
+type LocalStorage struct {
+	Root string
+}
+
+func (l *LocalStorage) path(key string) (string, error) {
+	cleaned, err := CleanStorageKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put writes the object to a temporary file first so readers never see a partial file
+func (l *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// Get opens the file of the object; the content type is derived from the key's extension
+func (l *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return file, contentType, nil
+}
+
+// Delete removes the file of the object
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
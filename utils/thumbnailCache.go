@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThumbnailCache downloads remote images and keeps them on disk. Each entry is an
+// image file with a JSON sidecar holding the validators returned by the origin.
+// Entries older than TTL are revalidated with a conditional request, and the least
+// recently served entries are evicted when the cache grows beyond MaxBytes.
+type ThumbnailCache struct {
+	Dir        string
+	MaxBytes   int64
+	TTL        time.Duration
+	MaxImage   int64
+	HTTPClient *http.Client
+
+	mu sync.Mutex
+}
+
+// CachedThumbnail is an image served from the cache. File stays readable even if
+// the entry is evicted meanwhile; the caller closes it.
+type CachedThumbnail struct {
+	File         *os.File
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// thumbnailMeta is stored next to each cached image
+type thumbnailMeta struct {
+	URL          string    `json:"url"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	SHA256       string    `json:"sha256"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+func (t *ThumbnailCache) client() *http.Client {
+	if t.HTTPClient != nil {
+		return t.HTTPClient
+	}
+	return HTTPClient
+}
+
+func (t *ThumbnailCache) paths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(t.Dir, name+".img"), filepath.Join(t.Dir, name+".json")
+}
+
+func (t *ThumbnailCache) readMeta(path string) (*thumbnailMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var meta thumbnailMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// Get returns the cached image of url, downloading or revalidating it when needed.
+// When the origin is unreachable a stale copy is served rather than an error.
+// The caller closes the File of the returned thumbnail.
+func (t *ThumbnailCache) Get(ctx context.Context, url string) (*CachedThumbnail, error) {
+	imagePath, metaPath := t.paths(url)
+
+	meta, err := t.readMeta(metaPath)
+	if err != nil {
+		meta = nil
+	} else if _, err := os.Stat(imagePath); err != nil {
+		meta = nil
+	}
+
+	if meta == nil || time.Since(meta.FetchedAt) > t.TTL {
+		fresh, err := t.fetch(ctx, url, meta, imagePath, metaPath)
+		if err != nil && meta == nil {
+			return nil, err
+		}
+		if err == nil {
+			meta = fresh
+		}
+	}
+
+	file, err := t.open(imagePath)
+	if errors.Is(err, os.ErrNotExist) {
+		// The image was evicted since it was checked: download it again
+		meta, err = t.fetch(ctx, url, nil, imagePath, metaPath)
+		if err != nil {
+			return nil, err
+		}
+		file, err = t.open(imagePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cached := &CachedThumbnail{File: file, ContentType: meta.ContentType, ETag: meta.ETag}
+	if meta.LastModified != "" {
+		cached.LastModified, _ = http.ParseTime(meta.LastModified)
+	}
+	if cached.ETag == "" {
+		// Give clients a validator even when the origin sends none
+		cached.ETag = `"` + meta.SHA256 + `"`
+	}
+	return cached, nil
+}
+
+// open opens a cached image and records the access for eviction in its modification
+// time. Holding t.mu keeps evict from removing the image while it is being opened.
+func (t *ThumbnailCache) open(imagePath string) (*os.File, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(imagePath, now, now)
+	return file, nil
+}
+
+// fetch downloads url, sending the validators of the cached copy when there is one
+func (t *ThumbnailCache) fetch(ctx context.Context, url string, cached *thumbnailMeta, imagePath, metaPath string) (*thumbnailMeta, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := t.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		cached.FetchedAt = time.Now()
+		return cached, t.writeMeta(metaPath, cached)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error %d from %s", resp.StatusCode, url)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("unexpected content type %q from %s", contentType, url)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, t.MaxImage+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > t.MaxImage {
+		return nil, errors.New("image too large")
+	}
+
+	sum := sha256.Sum256(data)
+	meta := &thumbnailMeta{
+		URL:          url,
+		SHA256:       hex.EncodeToString(sum[:]),
+		ContentType:  contentType,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(imagePath, data); err != nil {
+		return nil, err
+	}
+	if err := t.writeMeta(metaPath, meta); err != nil {
+		return nil, err
+	}
+	t.evict(imagePath)
+	return meta, nil
+}
+
+func (t *ThumbnailCache) writeMeta(path string, meta *thumbnailMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces a file through a temporary file so readers never see partial content
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// evict removes the least recently served images until the cache fits in MaxBytes.
+// The image that was just stored is kept. Callers hold t.mu.
+func (t *ThumbnailCache) evict(keep string) {
+	entries, err := os.ReadDir(t.Dir)
+	if err != nil {
+		return
+	}
+
+	type cachedFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cachedFile
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".img") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cachedFile{filepath.Join(t.Dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, file := range files {
+		if total <= t.MaxBytes {
+			break
+		}
+		if file.path == keep {
+			continue
+		}
+		os.Remove(file.path)
+		os.Remove(strings.TrimSuffix(file.path, ".img") + ".json")
+		total -= file.size
+	}
+}
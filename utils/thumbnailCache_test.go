@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThumbnailCacheEviction(t *testing.T) {
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		w.Header().Set("Content-Type", "image/jpeg")
+		io.WriteString(w, "image of "+r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	// The cache only holds one image
+	cache := &ThumbnailCache{Dir: t.TempDir(), MaxBytes: 20, TTL: time.Hour, MaxImage: 1024, HTTPClient: server.Client()}
+	ctx := context.Background()
+
+	first, err := cache.Get(ctx, server.URL+"/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.File.Close()
+
+	second, err := cache.Get(ctx, server.URL+"/second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.File.Close()
+	if entries, _ := os.ReadDir(cache.Dir); len(entries) != 2 {
+		t.Errorf("cache holds %d files, want the second image and its metadata", len(entries))
+	}
+
+	// An image being served stays readable after its eviction
+	if data, err := io.ReadAll(first.File); err != nil || string(data) != "image of /first" {
+		t.Errorf("evicted image read %q, %v", data, err)
+	}
+
+	// Evicted images are downloaded again, cached ones are not
+	again, err := cache.Get(ctx, server.URL+"/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.File.Close()
+	if downloads.Load() != 3 {
+		t.Errorf("%d downloads, want 3", downloads.Load())
+	}
+	cached, err := cache.Get(ctx, server.URL+"/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.File.Close()
+	if downloads.Load() != 3 {
+		t.Errorf("%d downloads, want the cached image to be served", downloads.Load())
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ExtractVideoID extracts the YouTube video ID from a URL
@@ -33,14 +35,55 @@ type VideoInfo struct {
 	Title        string
 	ThumbnailURL string
 	ViewCount    int64
+
+	// Only known when the YouTube Data API is used
+	LikeCount   int64
+	Duration    time.Duration
+	PublishedAt *time.Time
+}
+
+// VideoInfoProvider looks up information about YouTube videos
+type VideoInfoProvider interface {
+	GetVideoInfo(ctx context.Context, videoID string) (*VideoInfo, error)
+}
+
+// ScraperProvider reads video information from the oEmbed endpoint and the watch page
+type ScraperProvider struct {
+	// BaseURL defaults to https://www.youtube.com
+	BaseURL string
+	// HTTPClient defaults to the shared HTTPClient
+	HTTPClient *http.Client
+}
+
+func (s ScraperProvider) baseURL() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return "https://www.youtube.com"
+}
+
+func (s ScraperProvider) client() *http.Client {
+	if s.HTTPClient != nil {
+		return s.HTTPClient
+	}
+	return HTTPClient
 }
 
 // GetVideoInfo fetches video information from YouTube
 // This function uses oEmbed API for title and thumbnail, and scrapes the page for view count
-func GetVideoInfo(videoID string) (*VideoInfo, error) {
-	oembedURL := fmt.Sprintf("https://www.youtube.com/oembed?url=https://www.youtube.com/watch?v=%s&format=json", videoID)
+func GetVideoInfo(ctx context.Context, videoID string) (*VideoInfo, error) {
+	return ScraperProvider{}.GetVideoInfo(ctx, videoID)
+}
+
+// GetVideoInfo implements VideoInfoProvider
+func (s ScraperProvider) GetVideoInfo(ctx context.Context, videoID string) (*VideoInfo, error) {
+	oembedURL := fmt.Sprintf("%s/oembed?url=https://www.youtube.com/watch?v=%s&format=json", s.baseURL(), videoID)
 
-	resp, err := http.Get(oembedURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, oembedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("erreur lors de la récupération des informations: %v", err)
 	}
@@ -60,7 +103,7 @@ func GetVideoInfo(videoID string) (*VideoInfo, error) {
 	}
 
 	// Get view count by scraping the page
-	viewCount, err := getViewCount(videoID)
+	viewCount, err := s.getViewCount(ctx, videoID)
 	if err != nil {
 		// If we can't get view count, set it to 0 (non-critical)
 		viewCount = 0
@@ -74,11 +117,10 @@ func GetVideoInfo(videoID string) (*VideoInfo, error) {
 }
 
 // getViewCount scrapes the view count from YouTube page
-func getViewCount(videoID string) (int64, error) {
-	url := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
+func (s ScraperProvider) getViewCount(ctx context.Context, videoID string) (int64, error) {
+	url := fmt.Sprintf("%s/watch?v=%s", s.baseURL(), videoID)
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -86,7 +128,7 @@ func getViewCount(videoID string) (int64, error) {
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
 
-	resp, err := client.Do(req)
+	resp, err := s.client().Do(req)
 	if err != nil {
 		return 0, err
 	}
@@ -101,20 +143,24 @@ func getViewCount(videoID string) (int64, error) {
 		return 0, err
 	}
 
-	bodyStr := string(body)
+	return parseViewCount(string(body))
+}
 
-	// Try to find view count in ytInitialData (most reliable)
-	// Look for "viewCount" in the JSON data embedded in the page
-	viewCountPatterns := []string{
-		`"viewCount":\s*"(\d+)"`,
-		`"viewCount":\s*(\d+)`,
-		`"simpleText":"([\d\s,]+)\s*vues"`,
-		`"viewCountText":\s*\{[^}]*"simpleText":"([\d\s,]+)\s*vues"`,
-		`"runs":\s*\[[^\]]*"text":"([\d\s,]+)\s*vues"`,
-	}
+// viewCountPatterns find the view count in the ytInitialData embedded in the watch page,
+// most reliable first
+var viewCountPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`"viewCount":\s*"(\d+)"`),
+	regexp.MustCompile(`"viewCount":\s*(\d+)`),
+	regexp.MustCompile(`"simpleText":"([\d\s,]+)\s*vues"`),
+	regexp.MustCompile(`"viewCountText":\s*\{[^}]*"simpleText":"([\d\s,]+)\s*vues"`),
+	regexp.MustCompile(`"runs":\s*\[[^\]]*"text":"([\d\s,]+)\s*vues"`),
+}
 
-	for _, pattern := range viewCountPatterns {
-		re := regexp.MustCompile(pattern)
+var jsonLDPattern = regexp.MustCompile(`<script[^>]*type="application/ld\+json"[^>]*>(.*?)</script>`)
+
+// parseViewCount extracts the view count from the HTML of a watch page
+func parseViewCount(bodyStr string) (int64, error) {
+	for _, re := range viewCountPatterns {
 		matches := re.FindAllStringSubmatch(bodyStr, -1)
 		for _, match := range matches {
 			if len(match) > 1 {
@@ -129,7 +175,6 @@ func getViewCount(videoID string) (int64, error) {
 	}
 
 	// Try to find in JSON-LD structured data
-	jsonLDPattern := regexp.MustCompile(`<script[^>]*type="application/ld\+json"[^>]*>(.*?)</script>`)
 	jsonLDMatches := jsonLDPattern.FindAllStringSubmatch(bodyStr, -1)
 	for _, match := range jsonLDMatches {
 		if len(match) > 1 {
@@ -157,11 +202,11 @@ func getViewCount(videoID string) (int64, error) {
 }
 
 // GetVideoInfoFromURL extracts video ID and fetches all video information
-func GetVideoInfoFromURL(url string) (*VideoInfo, error) {
+func GetVideoInfoFromURL(ctx context.Context, url string) (*VideoInfo, error) {
 	videoID, err := ExtractVideoID(url)
 	if err != nil {
 		return nil, err
 	}
 
-	return GetVideoInfo(videoID)
+	return GetVideoInfo(ctx, videoID)
 }
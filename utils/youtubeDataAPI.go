@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ErrVideoNotFound is returned when YouTube has no public video with the ID
+var ErrVideoNotFound = errors.New("video not found")
+
+// isoDuration matches the ISO 8601 durations of the Data API, e.g. PT1H2M10S or P1DT2H
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// YouTubeDataAPI reads video information from the YouTube Data API v3, which needs an API key
+// but returns exact statistics, the duration and the publish date
+type YouTubeDataAPI struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewYouTubeDataAPI returns a client for the public YouTube Data API
+func NewYouTubeDataAPI(apiKey string) *YouTubeDataAPI {
+	return &YouTubeDataAPI{APIKey: apiKey, BaseURL: "https://www.googleapis.com/youtube/v3"}
+}
+
+func (y *YouTubeDataAPI) client() *http.Client {
+	if y.HTTPClient != nil {
+		return y.HTTPClient
+	}
+	return HTTPClient
+}
+
+// GetVideoInfo fetches the snippet, statistics and content details of a video
+func (y *YouTubeDataAPI) GetVideoInfo(ctx context.Context, videoID string) (*VideoInfo, error) {
+	query := url.Values{
+		"part": {"snippet,statistics,contentDetails"},
+		"id":   {videoID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, y.BaseURL+"/videos?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// The key goes in a header rather than the query, so errors quoting the URL never contain it
+	req.Header.Set("X-Goog-Api-Key", y.APIKey)
+	resp, err := y.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("YouTube Data API error %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Items []struct {
+			Snippet struct {
+				Title       string `json:"title"`
+				PublishedAt string `json:"publishedAt"`
+				Thumbnails  map[string]struct {
+					URL string `json:"url"`
+				} `json:"thumbnails"`
+			} `json:"snippet"`
+			Statistics struct {
+				ViewCount string `json:"viewCount"`
+				LikeCount string `json:"likeCount"`
+			} `json:"statistics"`
+			ContentDetails struct {
+				Duration string `json:"duration"`
+			} `json:"contentDetails"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid YouTube Data API response: %w", err)
+	}
+	if len(result.Items) == 0 {
+		return nil, ErrVideoNotFound
+	}
+	item := result.Items[0]
+
+	info := &VideoInfo{Title: item.Snippet.Title}
+	// Prefer the thumbnail size oEmbed returns, then smaller ones
+	for _, size := range []string{"high", "medium", "default"} {
+		if thumbnail, ok := item.Snippet.Thumbnails[size]; ok && thumbnail.URL != "" {
+			info.ThumbnailURL = thumbnail.URL
+			break
+		}
+	}
+	// Counts are strings; likes are missing when the owner hides them
+	info.ViewCount, _ = strconv.ParseInt(item.Statistics.ViewCount, 10, 64)
+	info.LikeCount, _ = strconv.ParseInt(item.Statistics.LikeCount, 10, 64)
+	info.Duration = parseISODuration(item.ContentDetails.Duration)
+	if publishedAt, err := time.Parse(time.RFC3339, item.Snippet.PublishedAt); err == nil {
+		info.PublishedAt = &publishedAt
+	}
+	return info, nil
+}
+
+// parseISODuration converts an ISO 8601 duration, returning 0 when it cannot be parsed
+func parseISODuration(value string) time.Duration {
+	matches := isoDuration.FindStringSubmatch(value)
+	if matches == nil {
+		return 0
+	}
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if n, err := strconv.Atoi(matches[i+1]); err == nil {
+			total += time.Duration(n) * unit
+		}
+	}
+	return total
+}
+
+// FallbackProvider asks Primary first and Fallback when Primary fails for
+// another reason than an unknown video, e.g. when the API quota is exhausted
+type FallbackProvider struct {
+	Primary  VideoInfoProvider
+	Fallback VideoInfoProvider
+}
+
+// GetVideoInfo implements VideoInfoProvider
+func (f *FallbackProvider) GetVideoInfo(ctx context.Context, videoID string) (*VideoInfo, error) {
+	info, err := f.Primary.GetVideoInfo(ctx, videoID)
+	if err == nil || errors.Is(err, ErrVideoNotFound) || ctx.Err() != nil {
+		return info, err
+	}
+	slog.WarnContext(ctx, "Video info lookup failed, using the fallback", "video_id", videoID, "error", err)
+	return f.Fallback.GetVideoInfo(ctx, videoID)
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveFixture answers every request with a recorded response from testdata/youtube
+func serveFixture(t *testing.T, status int, name string, check func(r *http.Request)) *httptest.Server {
+	t.Helper()
+	body := readFixture(t, name)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestDataAPI returns a Data API client talking to server without retries
+func newTestDataAPI(server *httptest.Server) *YouTubeDataAPI {
+	return &YouTubeDataAPI{APIKey: "test-key", BaseURL: server.URL, HTTPClient: server.Client()}
+}
+
+func TestYouTubeDataAPIGetVideoInfo(t *testing.T) {
+	server := serveFixture(t, http.StatusOK, "data_api_video.json", func(r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/videos" || query.Get("id") != "dQw4w9WgXcQ" || query.Has("key") ||
+			query.Get("part") != "snippet,statistics,contentDetails" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if r.Header.Get("X-Goog-Api-Key") != "test-key" {
+			t.Errorf("API key header %q", r.Header.Get("X-Goog-Api-Key"))
+		}
+	})
+
+	info, err := newTestDataAPI(server).GetVideoInfo(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Title != "Rick Astley - Never Gonna Give You Up (Official Music Video)" {
+		t.Errorf("title = %q", info.Title)
+	}
+	if info.ThumbnailURL != "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" {
+		t.Errorf("thumbnail = %q", info.ThumbnailURL)
+	}
+	if info.ViewCount != 1617654133 {
+		t.Errorf("views = %d", info.ViewCount)
+	}
+	if info.LikeCount != 18260510 {
+		t.Errorf("likes = %d", info.LikeCount)
+	}
+	if info.Duration != 3*time.Minute+33*time.Second {
+		t.Errorf("duration = %s", info.Duration)
+	}
+	if info.PublishedAt == nil || !info.PublishedAt.Equal(time.Date(2009, 10, 25, 6, 57, 33, 0, time.UTC)) {
+		t.Errorf("published at = %v", info.PublishedAt)
+	}
+}
+
+func TestYouTubeDataAPIVideoNotFound(t *testing.T) {
+	server := serveFixture(t, http.StatusOK, "data_api_empty.json", nil)
+
+	_, err := newTestDataAPI(server).GetVideoInfo(context.Background(), "xxxxxxxxxxx")
+	if !errors.Is(err, ErrVideoNotFound) {
+		t.Fatalf("err = %v, want ErrVideoNotFound", err)
+	}
+}
+
+func TestYouTubeDataAPIQuotaExceeded(t *testing.T) {
+	server := serveFixture(t, http.StatusForbidden, "data_api_quota_exceeded.json", nil)
+
+	_, err := newTestDataAPI(server).GetVideoInfo(context.Background(), "dQw4w9WgXcQ")
+	if err == nil || errors.Is(err, ErrVideoNotFound) {
+		t.Fatalf("err = %v, want an API error", err)
+	}
+}
+
+func TestYouTubeDataAPIErrorsHideKey(t *testing.T) {
+	// A server that is gone makes the client fail with an error quoting the URL
+	server := serveFixture(t, http.StatusOK, "data_api_video.json", nil)
+	api := newTestDataAPI(server)
+	server.Close()
+
+	_, err := api.GetVideoInfo(context.Background(), "dQw4w9WgXcQ")
+	if err == nil {
+		t.Fatal("request to a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), "test-key") {
+		t.Errorf("error contains the API key: %v", err)
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"PT3M33S":   3*time.Minute + 33*time.Second,
+		"PT1H2M10S": time.Hour + 2*time.Minute + 10*time.Second,
+		"PT45S":     45 * time.Second,
+		"P1DT2H":    26 * time.Hour,
+		"P0D":       0,
+		"":          0,
+		"3:33":      0,
+	}
+	for value, want := range tests {
+		if got := parseISODuration(value); got != want {
+			t.Errorf("parseISODuration(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+// stubProvider returns a fixed result and counts its calls
+type stubProvider struct {
+	info  *VideoInfo
+	err   error
+	calls int
+}
+
+func (s *stubProvider) GetVideoInfo(ctx context.Context, videoID string) (*VideoInfo, error) {
+	s.calls++
+	return s.info, s.err
+}
+
+func TestFallbackProviderUsesFallbackOnAPIError(t *testing.T) {
+	server := serveFixture(t, http.StatusForbidden, "data_api_quota_exceeded.json", nil)
+	fallback := &stubProvider{info: &VideoInfo{Title: "scraped"}}
+	provider := &FallbackProvider{Primary: newTestDataAPI(server), Fallback: fallback}
+
+	info, err := provider.GetVideoInfo(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "scraped" || fallback.calls != 1 {
+		t.Errorf("got %+v after %d fallback calls", info, fallback.calls)
+	}
+}
+
+func TestFallbackProviderKeepsNotFound(t *testing.T) {
+	server := serveFixture(t, http.StatusOK, "data_api_empty.json", nil)
+	fallback := &stubProvider{info: &VideoInfo{Title: "scraped"}}
+	provider := &FallbackProvider{Primary: newTestDataAPI(server), Fallback: fallback}
+
+	if _, err := provider.GetVideoInfo(context.Background(), "xxxxxxxxxxx"); !errors.Is(err, ErrVideoNotFound) {
+		t.Fatalf("err = %v, want ErrVideoNotFound", err)
+	}
+	if fallback.calls != 0 {
+		t.Errorf("fallback called %d times", fallback.calls)
+	}
+}
+
+func TestFallbackProviderScrapesWatchPage(t *testing.T) {
+	youtube := replayYouTube(t, "watch_page.html", nil)
+	api := serveFixture(t, http.StatusForbidden, "data_api_quota_exceeded.json", nil)
+	provider := &FallbackProvider{
+		Primary:  newTestDataAPI(api),
+		Fallback: ScraperProvider{BaseURL: youtube.URL, HTTPClient: youtube.Client()},
+	}
+
+	info, err := provider.GetVideoInfo(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "Rick Astley - Never Gonna Give You Up (Official Music Video)" || info.ViewCount != 1617654133 {
+		t.Errorf("got %+v", info)
+	}
+}
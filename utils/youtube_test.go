@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata/youtube were recorded from youtube.com and trimmed down to
+// the parts the scraper reads. Record them again when YouTube changes its pages.
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", "youtube", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// replayYouTube serves the recorded oEmbed response and the given watch page fixture.
+// A missing fixture name makes the endpoint answer with a 404.
+func replayYouTube(t *testing.T, watchPage string, check func(r *http.Request)) *httptest.Server {
+	t.Helper()
+	oembed := readFixture(t, "oembed.json")
+	var page []byte
+	if watchPage != "" {
+		page = readFixture(t, watchPage)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		switch {
+		case r.URL.Path == "/oembed":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(oembed)
+		case r.URL.Path == "/watch" && page != nil:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExtractVideoID(t *testing.T) {
+	tests := map[string]string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":                  "dQw4w9WgXcQ",
+		"https://youtube.com/watch?v=dQw4w9WgXcQ&t=42s":                "dQw4w9WgXcQ",
+		"https://www.youtube.com/watch?feature=share&v=dQw4w9WgXcQ":    "dQw4w9WgXcQ",
+		"https://youtu.be/dQw4w9WgXcQ":                                 "dQw4w9WgXcQ",
+		"https://www.youtube.com/embed/dQw4w9WgXcQ?autoplay=1":         "dQw4w9WgXcQ",
+		"https://www.youtube.com/watch?v=a_b-c_d-e_f&list=PL123456789": "a_b-c_d-e_f",
+	}
+	for url, want := range tests {
+		got, err := ExtractVideoID(url)
+		if err != nil || got != want {
+			t.Errorf("ExtractVideoID(%q) = %q, %v; want %q", url, got, err, want)
+		}
+	}
+
+	for _, url := range []string{"", "https://vimeo.com/123456", "https://www.youtube.com/watch?v=short"} {
+		if _, err := ExtractVideoID(url); err == nil {
+			t.Errorf("ExtractVideoID(%q) succeeded", url)
+		}
+	}
+}
+
+func TestScraperGetVideoInfo(t *testing.T) {
+	server := replayYouTube(t, "watch_page.html", func(r *http.Request) {
+		switch r.URL.Path {
+		case "/oembed":
+			query := r.URL.Query()
+			if query.Get("url") != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" || query.Get("format") != "json" {
+				t.Errorf("unexpected oEmbed request %s", r.URL)
+			}
+		case "/watch":
+			if r.URL.Query().Get("v") != "dQw4w9WgXcQ" {
+				t.Errorf("unexpected watch page request %s", r.URL)
+			}
+			if !strings.HasPrefix(r.Header.Get("User-Agent"), "Mozilla/5.0") {
+				t.Errorf("watch page requested with User-Agent %q", r.Header.Get("User-Agent"))
+			}
+		}
+	})
+	scraper := ScraperProvider{BaseURL: server.URL + "/", HTTPClient: server.Client()}
+
+	info, err := scraper.GetVideoInfo(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "Rick Astley - Never Gonna Give You Up (Official Music Video)" {
+		t.Errorf("title = %q", info.Title)
+	}
+	if info.ThumbnailURL != "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" {
+		t.Errorf("thumbnail = %q", info.ThumbnailURL)
+	}
+	if info.ViewCount != 1617654133 {
+		t.Errorf("views = %d", info.ViewCount)
+	}
+}
+
+func TestScraperWithoutViewCount(t *testing.T) {
+	for _, watchPage := range []string{"", "watch_page_consent.html"} {
+		server := replayYouTube(t, watchPage, nil)
+		scraper := ScraperProvider{BaseURL: server.URL, HTTPClient: server.Client()}
+
+		info, err := scraper.GetVideoInfo(context.Background(), "dQw4w9WgXcQ")
+		if err != nil {
+			t.Fatalf("watch page %q: %v", watchPage, err)
+		}
+		if info.Title == "" || info.ViewCount != 0 {
+			t.Errorf("watch page %q: got %+v", watchPage, info)
+		}
+	}
+}
+
+func TestScraperOEmbedErrors(t *testing.T) {
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Unauthorized"))
+	}))
+	defer invalid.Close()
+
+	for _, server := range []*httptest.Server{notFound, invalid} {
+		scraper := ScraperProvider{BaseURL: server.URL, HTTPClient: server.Client()}
+		if info, err := scraper.GetVideoInfo(context.Background(), "dQw4w9WgXcQ"); err == nil {
+			t.Errorf("got %+v, want an error", info)
+		}
+	}
+}
+
+// viewCountFixtures holds, for each entry of viewCountPatterns, a watch page using that format
+var viewCountFixtures = []string{
+	"watch_page.html",
+	"watch_page_numeric.html",
+	"watch_page_simple_text.html",
+	"watch_page_view_count_text.html",
+	"watch_page_runs.html",
+}
+
+func TestViewCountPatterns(t *testing.T) {
+	if len(viewCountFixtures) != len(viewCountPatterns) {
+		t.Fatalf("%d fixtures for %d view count patterns", len(viewCountFixtures), len(viewCountPatterns))
+	}
+	for i, pattern := range viewCountPatterns {
+		if !pattern.Match(readFixture(t, viewCountFixtures[i])) {
+			t.Errorf("pattern %s does not match %s", pattern, viewCountFixtures[i])
+		}
+	}
+}
+
+func TestParseViewCount(t *testing.T) {
+	fixtures := append(viewCountFixtures, "watch_page_json_ld.html")
+	for _, name := range fixtures {
+		count, err := parseViewCount(string(readFixture(t, name)))
+		if err != nil || count != 1617654133 {
+			t.Errorf("%s: got %d, %v", name, count, err)
+		}
+	}
+
+	if count, err := parseViewCount(string(readFixture(t, "watch_page_consent.html"))); err == nil {
+		t.Errorf("consent page: got %d, want an error", count)
+	}
+}